@@ -0,0 +1,72 @@
+// adds copy and collapse buttons to code blocks marked by markdowner
+document.addEventListener("DOMContentLoaded", function() {
+	function button(label, title, onclick) {
+		var b = document.createElement("button");
+		b.type = "button";
+		b.textContent = label;
+		b.title = title;
+		b.addEventListener("click", onclick);
+		return b;
+	}
+
+	// text of code without line numbers
+	function codeText(pre) {
+		var code = (pre.querySelector("code") || pre).cloneNode(true);
+		var numbers = code.querySelectorAll(".ln, .lnt");
+		for (var i = 0; i < numbers.length; i++) {
+			numbers[i].parentNode.removeChild(numbers[i]);
+		}
+		return code.textContent;
+	}
+
+	function copy(text) {
+		if (navigator.clipboard && window.isSecureContext) {
+			return navigator.clipboard.writeText(text);
+		}
+		// clipboard api is not available on file:// pages in some browsers
+		var area = document.createElement("textarea");
+		area.value = text;
+		area.style.position = "fixed";
+		area.style.opacity = "0";
+		document.body.appendChild(area);
+		area.select();
+		try {
+			document.execCommand("copy");
+		} finally {
+			document.body.removeChild(area);
+		}
+		return Promise.resolve();
+	}
+
+	var blocks = document.querySelectorAll("pre[data-copy], pre[data-collapse]");
+	for (var i = 0; i < blocks.length; i++) {
+		(function(pre) {
+			var tools = document.createElement("div");
+			tools.className = "code-tools";
+
+			if (pre.hasAttribute("data-collapse")) {
+				var toggle = button("Collapse", "Collapse code", function() {
+					var collapsed = pre.classList.toggle("collapsed");
+					toggle.textContent = collapsed ? "Expand" : "Collapse";
+					toggle.title = collapsed ? "Expand code" : "Collapse code";
+				});
+				tools.appendChild(toggle);
+			}
+
+			if (pre.hasAttribute("data-copy")) {
+				var copyButton = button("Copy", "Copy code", function() {
+					copy(codeText(pre)).then(function() {
+						copyButton.textContent = "Copied!";
+					}, function() {
+						copyButton.textContent = "Failed";
+					});
+					setTimeout(function() { copyButton.textContent = "Copy"; }, 1500);
+				});
+				tools.appendChild(copyButton);
+			}
+
+			pre.classList.add("has-code-tools");
+			pre.insertBefore(tools, pre.firstChild);
+		})(blocks[i]);
+	}
+});
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"github.com/taq-f/miniature-potato/renderer"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// names of configuration files looked up in directories, in order of priority
+var configNames = []string{"markdowner.yaml", "markdowner.yml", "markdowner.toml"}
+
+// keys of options which apply to the whole build, and can be set only in the
+// configuration of the input root
+var rootOnlyKeys = map[string]bool{
+	"out": true, "verbose": true, "quiet": true, "log-format": true,
+	"jobs": true, "force": true, "site": true, "check": true,
+	"watch": true, "serve": true, "report": true, "report-file": true,
+	"include": true, "exclude": true, "extensions": true,
+}
+
+// options given by command line flags and configuration files. keys in
+// configuration files are the tags.
+type options struct {
+	OutDir         string   `yaml:"out" toml:"out"`
+	ImageInline    bool     `yaml:"image-inline" toml:"image-inline"`
+	Template       string   `yaml:"template" toml:"template"`
+	Style          string   `yaml:"style" toml:"style"`
+	Partials       string   `yaml:"partials" toml:"partials"`
+	Verbose        bool     `yaml:"verbose" toml:"verbose"`
+	Quiet          bool     `yaml:"quiet" toml:"quiet"`
+	LogFormat      string   `yaml:"log-format" toml:"log-format"`
+	Engine         string   `yaml:"engine" toml:"engine"`
+	MermaidCmd     string   `yaml:"mermaid-cmd" toml:"mermaid-cmd"`
+	PlantUMLCmd    string   `yaml:"plantuml-cmd" toml:"plantuml-cmd"`
+	PlantUMLServer string   `yaml:"plantuml-server" toml:"plantuml-server"`
+	Math           bool     `yaml:"math" toml:"math"`
+	MathAssets     string   `yaml:"math-assets" toml:"math-assets"`
+	Theme          string   `yaml:"theme" toml:"theme"`
+	CopyButton     bool     `yaml:"copy" toml:"copy"`
+	CollapseButton bool     `yaml:"collapse" toml:"collapse"`
+	TOCMin         int      `yaml:"toc-min" toml:"toc-min"`
+	TOCMax         int      `yaml:"toc-max" toml:"toc-max"`
+	Jobs           int      `yaml:"jobs" toml:"jobs"`
+	Force          bool     `yaml:"force" toml:"force"`
+	Site           bool     `yaml:"site" toml:"site"`
+	Check          bool     `yaml:"check" toml:"check"`
+	Watch          bool     `yaml:"watch" toml:"watch"`
+	Serve          string   `yaml:"serve" toml:"serve"`
+	Report         string   `yaml:"report" toml:"report"`
+	ReportFile     string   `yaml:"report-file" toml:"report-file"`
+	Include        patterns `yaml:"include" toml:"include"`
+	Exclude        patterns `yaml:"exclude" toml:"exclude"`
+	Extensions     list     `yaml:"extensions" toml:"extensions"`
+}
+
+// list is a flag of comma separated values
+type list []string
+
+func (l *list) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *list) Set(value string) error {
+	*l = nil
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+func defaultOptions() options {
+	return options{
+		LogFormat:  logFormatText,
+		Engine:     renderer.EngineBlackfriday,
+		Theme:      renderer.DefaultTheme,
+		TOCMin:     1,
+		TOCMax:     6,
+		Jobs:       runtime.NumCPU(),
+		Extensions: append(list{}, renderer.DefaultExtensions...),
+	}
+}
+
+// bind options to flags of the flag set. current values are the defaults.
+func (o *options) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.OutDir, "o", o.OutDir, "Output directory. If not specified, html file will be located in the same directory as the markdown file.")
+	fs.BoolVar(&o.ImageInline, "i", o.ImageInline, "Whether image files are embeded into html file. default: false.")
+	fs.StringVar(&o.Template, "t", o.Template, "custom html template file path.")
+	fs.StringVar(&o.Style, "s", o.Style, "custom stylesheet path")
+	fs.StringVar(&o.Partials, "p", o.Partials, "glob pattern of partial template files, which the template can include by file name without extension.")
+	fs.BoolVar(&o.Verbose, "v", o.Verbose, "Show details about processing. default false.")
+	fs.BoolVar(&o.Quiet, "q", o.Quiet, "Show only warnings and errors. default false.")
+	fs.StringVar(&o.LogFormat, "log-format", o.LogFormat, "Format of log: text or json. default: text.")
+	fs.StringVar(&o.Engine, "engine", o.Engine, "Markdown engine: blackfriday, commonmark or gfm (GitHub Flavored Markdown). default: blackfriday.")
+	fs.StringVar(&o.MermaidCmd, "mermaid-cmd", o.MermaidCmd, "Command converting mermaid diagram from stdin into svg. If not specified, diagrams are rendered in browsers.")
+	fs.StringVar(&o.PlantUMLCmd, "plantuml-cmd", o.PlantUMLCmd, "Command converting PlantUML diagram from stdin into svg, e.g. \"plantuml -tsvg -pipe\". If neither this nor -plantuml-server is specified, diagrams are left as code blocks.")
+	fs.StringVar(&o.PlantUMLServer, "plantuml-server", o.PlantUMLServer, "PlantUML server used when -plantuml-cmd is not specified, e.g. \"https://www.plantuml.com/plantuml\". Diagram sources are sent to it.")
+	fs.BoolVar(&o.Math, "math", o.Math, "Render $...$ and $$...$$ as math with KaTeX. default: false.")
+	fs.StringVar(&o.MathAssets, "math-assets", o.MathAssets, "KaTeX distribution directory embedded into html for offline use. If not specified, KaTeX is loaded from CDN.")
+	fs.StringVar(&o.Theme, "theme", o.Theme, "Color theme of syntax highlighting, such as github, monokai or solarized-dark.")
+	fs.BoolVar(&o.CopyButton, "copy", o.CopyButton, "Add a button copying code to each code block. default: false.")
+	fs.BoolVar(&o.CollapseButton, "collapse", o.CollapseButton, "Add a button collapsing code to each code block. default: false.")
+	fs.IntVar(&o.TOCMin, "toc-min", o.TOCMin, "The smallest heading level listed in table of contents. default: 1.")
+	fs.IntVar(&o.TOCMax, "toc-max", o.TOCMax, "The largest heading level listed in table of contents. default: 6.")
+	fs.IntVar(&o.Jobs, "j", o.Jobs, "Number of files rendered in parallel. default: number of CPUs.")
+	fs.BoolVar(&o.Force, "force", o.Force, "Render all files even if they and their inputs are unchanged since the last build. default: false.")
+	fs.BoolVar(&o.Site, "site", o.Site, "Generate index pages for directories and navigation between documents. default: false.")
+	fs.BoolVar(&o.Check, "check", o.Check, "Check links, anchors and images in markdown files instead of converting them. exits with 1 if any problem is found. default: false.")
+	fs.BoolVar(&o.Watch, "w", o.Watch, "Watch modification of markdown files and refresh html file as modification. default: false.")
+	fs.StringVar(&o.Serve, "serve", o.Serve, "Serve output directory over HTTP on the address (e.g. :8080) and reload browsers as files are refreshed. implies -w.")
+	fs.StringVar(&o.Report, "report", o.Report, "Write a build report in the format: json. If not specified, no report is written.")
+	fs.StringVar(&o.ReportFile, "report-file", o.ReportFile, "File the build report is written to. If not specified, it is written to stdout and logs to stderr.")
+	fs.Var(&o.Include, "include", "Glob pattern of markdown files rendered, relative to the input directory. can be repeated. If not specified, all markdown files are rendered.")
+	fs.Var(&o.Exclude, "exclude", "Glob pattern of files and directories not rendered nor watched, relative to the input directory. can be repeated.")
+	fs.Var(&o.Extensions, "ext", "Comma separated extensions of markdown files, which are matched ignoring case.")
+}
+
+// paths in options, which are relative to the configuration file
+func (o *options) paths() []*string {
+	return []*string{&o.OutDir, &o.Template, &o.Style, &o.Partials, &o.MathAssets, &o.ReportFile}
+}
+
+// names and values of flags given in command line
+func setFlags(fs *flag.FlagSet) map[string]string {
+	set := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = f.Value.String()
+	})
+	return set
+}
+
+// apply flags given in command line, which take precedence over
+// configuration files
+func (o *options) applyFlags(set map[string]string) {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	o.bind(fs)
+	for name, value := range set {
+		if p, ok := fs.Lookup(name).Value.(*patterns); ok {
+			// patterns of flags replace those of configuration
+			*p = nil
+		}
+		// values were accepted by the command line
+		fs.Set(name, value)
+	}
+}
+
+// load options for the input root and for directories under it which have
+// their own configuration. each configuration overrides the one of its
+// parent directory, and flags take precedence over all of them.
+func loadOptions(root string, set map[string]string, nested bool) (options, map[string]options, error) {
+	opts := defaultOptions()
+	if path := findConfig(root); path != "" {
+		if err := loadConfig(&opts, path, false); err != nil {
+			return opts, nil, err
+		}
+	}
+
+	overrides := map[string]options{}
+	if nested {
+		// parents are walked before their children
+		for _, dir := range getDirectories(root, nil) {
+			path := findConfig(dir)
+			if dir == root || path == "" {
+				continue
+			}
+
+			o := opts
+			for parent := filepath.Dir(dir); parent != root && parent != filepath.Dir(parent); parent = filepath.Dir(parent) {
+				if p, ok := overrides[parent]; ok {
+					o = p
+					break
+				}
+			}
+			if err := loadConfig(&o, path, true); err != nil {
+				return opts, nil, err
+			}
+			overrides[dir] = o
+		}
+	}
+
+	opts.applyFlags(set)
+	for dir, o := range overrides {
+		o.applyFlags(set)
+		overrides[dir] = o
+	}
+	return opts, overrides, nil
+}
+
+// get the configuration file in dir, or empty if it has none
+func findConfig(dir string) string {
+	for _, name := range configNames {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// load the configuration file onto opts. relative paths in it are resolved
+// against its directory. nested is true for configuration of a subdirectory.
+func loadConfig(opts *options, path string, nested bool) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read configuration %s", path)
+	}
+
+	isTOML := filepath.Ext(path) == ".toml"
+
+	var keys map[string]interface{}
+	if isTOML {
+		_, err = toml.Decode(string(data), &keys)
+	} else {
+		err = yaml.Unmarshal(data, &keys)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "invalid configuration %s", path)
+	}
+
+	known := optionKeys()
+	var unknown, rootOnly []string
+	for key := range keys {
+		switch {
+		case !known[key]:
+			unknown = append(unknown, key)
+		case nested && rootOnlyKeys[key]:
+			rootOnly = append(rootOnly, key)
+		}
+	}
+	if len(unknown) > 0 {
+		var valid []string
+		for key := range known {
+			valid = append(valid, key)
+		}
+		sort.Strings(unknown)
+		sort.Strings(valid)
+		return errors.Errorf("invalid configuration %s: unknown keys: %s (valid keys: %s)",
+			path, strings.Join(unknown, ", "), strings.Join(valid, ", "))
+	}
+	if len(rootOnly) > 0 {
+		sort.Strings(rootOnly)
+		return errors.Errorf("invalid configuration %s: %s can be set only in the configuration of the input root",
+			path, strings.Join(rootOnly, ", "))
+	}
+
+	before := *opts
+	if isTOML {
+		_, err = toml.Decode(string(data), opts)
+	} else {
+		err = yaml.UnmarshalStrict(data, opts)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "invalid configuration %s", path)
+	}
+
+	for _, pattern := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "invalid configuration %s: invalid pattern %s", path, pattern)
+		}
+	}
+
+	beforePaths := before.paths()
+	for i, p := range opts.paths() {
+		if *p != *beforePaths[i] && *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(filepath.Dir(path), *p)
+		}
+	}
+	return nil
+}
+
+// keys of options in configuration files
+func optionKeys() map[string]bool {
+	keys := map[string]bool{}
+	t := reflect.TypeOf(options{})
+	for i := 0; i < t.NumField(); i++ {
+		keys[t.Field(i).Tag.Get("yaml")] = true
+	}
+	return keys
+}
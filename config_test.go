@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	type TestCase struct {
+		name     string
+		content  string
+		nested   bool
+		expected options
+		err      string
+	}
+
+	withDefaults := func(f func(o *options)) options {
+		o := defaultOptions()
+		f(&o)
+		return o
+	}
+
+	testCases := []TestCase{
+		TestCase{"markdowner.yaml", "theme: monokai\ntoc-max: 3\ncopy: true\n", false,
+			withDefaults(func(o *options) { o.Theme, o.TOCMax, o.CopyButton = "monokai", 3, true }), ""},
+		TestCase{"markdowner.toml", "engine = \"gfm\"\nmath = true\n", false,
+			withDefaults(func(o *options) { o.Engine, o.Math = "gfm", true }), ""},
+		// paths are relative to the configuration
+		TestCase{"markdowner.yaml", "out: html\ntemplate: /abs/template.html\n", false,
+			withDefaults(func(o *options) { o.OutDir, o.Template = filepath.Join(dir, "html"), "/abs/template.html" }), ""},
+		TestCase{"markdowner.yaml", "exclude: [drafts, node_modules]\n", false,
+			withDefaults(func(o *options) { o.Exclude = patterns{"drafts", "node_modules"} }), ""},
+		TestCase{"markdowner.yaml", "include: [\"[docs\"]\n", false, defaultOptions(), "invalid pattern [docs"},
+		TestCase{"markdowner.yaml", "them: monokai\n", false, defaultOptions(), "unknown keys: them"},
+		TestCase{"markdowner.toml", "copy = true\nthem = \"monokai\"\n", false, defaultOptions(), "unknown keys: them"},
+		TestCase{"markdowner.yaml", "toc-max: many\n", false, defaultOptions(), "invalid configuration"},
+		TestCase{"markdowner.yaml", "theme: monokai\njobs: 2\n", true, defaultOptions(), "jobs can be set only"},
+	}
+
+	for i, testCase := range testCases {
+		path := filepath.Join(dir, testCase.name)
+		ioutil.WriteFile(path, []byte(testCase.content), 0644)
+
+		opts := defaultOptions()
+		err := loadConfig(&opts, path, testCase.nested)
+		os.Remove(path)
+
+		if testCase.err != "" {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Errorf("\n%d\ngot %v\nwant %v", i, err, testCase.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("\n%d\nunexpected error: %v", i, err)
+		}
+		if !reflect.DeepEqual(opts, testCase.expected) {
+			t.Errorf("\n%d\ngot %+v\nwant %+v", i, opts, testCase.expected)
+		}
+	}
+}
+
+func TestLoadOptions(t *testing.T) {
+	root, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	sub := filepath.Join(root, "sub")
+	deep := filepath.Join(sub, "deep")
+	os.MkdirAll(deep, 0755)
+	ioutil.WriteFile(filepath.Join(root, "markdowner.yaml"), []byte("theme: monokai\ntoc-max: 3\n"), 0644)
+	ioutil.WriteFile(filepath.Join(sub, "markdowner.toml"), []byte("theme = \"github\"\nmath = true\n"), 0644)
+	ioutil.WriteFile(filepath.Join(deep, "markdowner.yml"), []byte("toc-min: 2\n"), 0644)
+
+	// flags take precedence over all configuration
+	opts, overrides, err := loadOptions(root, map[string]string{"toc-max": "4"}, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if opts.Theme != "monokai" || opts.TOCMax != 4 || opts.Math {
+		t.Errorf("unexpected options of root: %+v", opts)
+	}
+	if o := overrides[sub]; o.Theme != "github" || o.TOCMax != 4 || !o.Math || o.TOCMin != 1 {
+		t.Errorf("unexpected options of %s: %+v", sub, o)
+	}
+	// the nearest parent configuration is inherited
+	if o := overrides[deep]; o.Theme != "github" || o.TOCMax != 4 || !o.Math || o.TOCMin != 2 {
+		t.Errorf("unexpected options of %s: %+v", deep, o)
+	}
+	if len(overrides) != 2 {
+		t.Errorf("\ngot %v\nwant %v", len(overrides), 2)
+	}
+}
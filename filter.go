@@ -0,0 +1,179 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	ignore "github.com/sabhiram/go-gitignore"
+)
+
+// name of the file listing files not rendered in gitignore syntax. each
+// directory can have one, which applies to its subtree.
+const ignoreFileName = ".markdownerignore"
+
+// patterns is a flag which can be repeated. patterns are matched against
+// slash separated paths as path.Match does, and ** matches any number of
+// directories.
+type patterns []string
+
+func (p *patterns) String() string {
+	return strings.Join(*p, "\n")
+}
+
+func (p *patterns) Set(value string) error {
+	for _, pattern := range strings.Split(value, "\n") {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "invalid pattern %s", pattern)
+		}
+		*p = append(*p, pattern)
+	}
+	return nil
+}
+
+// fileFilter decides which files and directories under the root are rendered
+// and watched.
+type fileFilter struct {
+	root string
+	// markdown files must match one of them if any
+	includes []string
+	// files and directories matching one of them are excluded
+	excludes []string
+	// ignore file of each directory visited, nil if it has none
+	ignores map[string]*ignore.GitIgnore
+}
+
+func newFileFilter(root string, includes, excludes []string) *fileFilter {
+	return &fileFilter{
+		root:     root,
+		includes: includes,
+		excludes: excludes,
+		ignores:  map[string]*ignore.GitIgnore{},
+	}
+}
+
+// see if the directory is walked
+func (f *fileFilter) allowDir(path string) bool {
+	if f == nil || path == f.root {
+		return true
+	}
+	return !f.excluded(path, true)
+}
+
+// see if the markdown file is rendered
+func (f *fileFilter) allowFile(path string) bool {
+	if f == nil {
+		return true
+	}
+	if f.excluded(path, false) {
+		return false
+	}
+	if len(f.includes) == 0 {
+		return true
+	}
+	return matchAny(f.includes, f.rel(path))
+}
+
+// see if the path is excluded by patterns or ignore files. only the path
+// itself is checked, since excluded directories are not walked.
+func (f *fileFilter) excluded(path string, dir bool) bool {
+	rel := f.rel(path)
+	if matchAny(f.excludes, rel) {
+		return true
+	}
+
+	for d := filepath.Dir(path); isUnder(f.root, d); d = filepath.Dir(d) {
+		gi := f.ignore(d)
+		if gi == nil {
+			continue
+		}
+		target, _ := filepath.Rel(d, path)
+		target = filepath.ToSlash(target)
+		if dir {
+			// patterns ending with slash match only directories
+			target += "/"
+		}
+		if gi.MatchesPath(target) {
+			return true
+		}
+		if d == f.root {
+			break
+		}
+	}
+	return false
+}
+
+// get the ignore file of the directory, compiling it the first time
+func (f *fileFilter) ignore(dir string) *ignore.GitIgnore {
+	gi, ok := f.ignores[dir]
+	if !ok {
+		path := filepath.Join(dir, ignoreFileName)
+		if _, err := os.Stat(path); err == nil {
+			gi, err = ignore.CompileIgnoreFile(path)
+			if err != nil {
+				logger.Warn("invalid ignore file", "path", path, "error", err)
+			}
+		}
+		f.ignores[dir] = gi
+	}
+	return gi
+}
+
+// path relative to the root, separated by slash
+func (f *fileFilter) rel(path string) string {
+	rel, err := filepath.Rel(f.root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// see if a pattern matches the relative path. patterns without slash match
+// the name of the file or any of its directories, like gitignore.
+func matchAny(patterns []string, rel string) bool {
+	names := strings.Split(rel, "/")
+	for _, pattern := range patterns {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+		if strings.Contains(pattern, "/") {
+			continue
+		}
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// see if the slash separated path matches the pattern
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(name) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], name[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], name[1:])
+}
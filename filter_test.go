@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetTargetFilesFiltered(t *testing.T) {
+	root, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, name := range []string{
+		"a.md", "b.md", "notes.txt",
+		"docs/c.md", "docs/secret.md", "docs/drafts/d.md",
+		"node_modules/pkg/readme.md", "vendor/e.md",
+		"guide/f.md", "guide/tmp/g.md",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, []byte("# "+name+"\n"), 0644)
+	}
+	ioutil.WriteFile(filepath.Join(root, ignoreFileName), []byte("# comment\ndrafts/\nvendor\n"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "docs", ignoreFileName), []byte("secret.md\n"), 0644)
+
+	type TestCase struct {
+		includes []string
+		excludes []string
+		expected string
+	}
+
+	testCases := []TestCase{
+		TestCase{nil, []string{"node_modules"}, "a.md,b.md,docs/c.md,guide/f.md,guide/tmp/g.md"},
+		TestCase{nil, []string{"node_modules", "guide/tmp"}, "a.md,b.md,docs/c.md,guide/f.md"},
+		TestCase{[]string{"docs/**/*.md", "guide"}, []string{"**/tmp"}, "docs/c.md,guide/f.md"},
+		TestCase{[]string{"a.md"}, nil, "a.md"},
+	}
+
+	for i, testCase := range testCases {
+		files, err := getTargetFiles(root, nil, newFileFilter(root, testCase.includes, testCase.excludes))
+		if err != nil {
+			t.Errorf("\n%d\nunexpected error: %v", i, err)
+			continue
+		}
+
+		var rels []string
+		for _, f := range files {
+			rel, _ := filepath.Rel(root, f)
+			rels = append(rels, filepath.ToSlash(rel))
+		}
+		if strings.Join(rels, ",") != testCase.expected {
+			t.Errorf("\n%d\ngot %v\nwant %v", i, strings.Join(rels, ","), testCase.expected)
+		}
+	}
+
+	// directories ignored are not watched
+	dirs := getDirectories(root, newFileFilter(root, nil, []string{"node_modules"}))
+	var rels []string
+	for _, d := range dirs {
+		rel, _ := filepath.Rel(root, d)
+		rels = append(rels, filepath.ToSlash(rel))
+	}
+	if strings.Join(rels, ",") != ".,docs,guide,guide/tmp" {
+		t.Errorf("\ngot %v\nwant %v", strings.Join(rels, ","), ".,docs,guide,guide/tmp")
+	}
+}
+
+func TestPatternsFlag(t *testing.T) {
+	opts := defaultOptions()
+	opts.Exclude = patterns{"from-config"}
+
+	// flags are repeated in command line
+	var cli patterns
+	cli.Set("drafts")
+	cli.Set("vendor")
+	opts.applyFlags(map[string]string{"exclude": cli.String()})
+
+	if strings.Join(opts.Exclude, ",") != "drafts,vendor" {
+		t.Errorf("\ngot %v\nwant %v", opts.Exclude, "drafts,vendor")
+	}
+
+	if err := cli.Set("[invalid"); err == nil {
+		t.Error("invalid pattern is accepted")
+	}
+}
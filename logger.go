@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// formats of log
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// levels of log messages
+type level int
+
+const (
+	levelDebug level = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+// prefixes of text log, and names of levels in JSON log
+var (
+	levelPrefixes = [...]string{"[DEBUG] ", "[INFO]  ", "[WARN]  ", "[ERRRR] "}
+	levelNames    = [...]string{"debug", "info", "warn", "error"}
+)
+
+// leveledLogger writes messages with fields, which are pairs of a key and a
+// value, as text or JSON lines. errors are written to errOut and the others
+// to out. it is also passed to the renderer.
+type leveledLogger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	errOut io.Writer
+	// messages below this level are discarded
+	min    level
+	format string
+	now    func() time.Time
+}
+
+func newLogger(out, errOut io.Writer, min level, format string) *leveledLogger {
+	return &leveledLogger{out: out, errOut: errOut, min: min, format: format, now: time.Now}
+}
+
+func (l *leveledLogger) Debug(msg string, fields ...interface{}) {
+	l.log(levelDebug, msg, fields)
+}
+
+func (l *leveledLogger) Info(msg string, fields ...interface{}) {
+	l.log(levelInfo, msg, fields)
+}
+
+func (l *leveledLogger) Warn(msg string, fields ...interface{}) {
+	l.log(levelWarn, msg, fields)
+}
+
+func (l *leveledLogger) Error(msg string, fields ...interface{}) {
+	l.log(levelError, msg, fields)
+}
+
+// Fatal writes the error and exits with 1
+func (l *leveledLogger) Fatal(msg string, fields ...interface{}) {
+	l.log(levelError, msg, fields)
+	os.Exit(1)
+}
+
+func (l *leveledLogger) log(lv level, msg string, fields []interface{}) {
+	if lv < l.min {
+		return
+	}
+
+	var line string
+	if l.format == logFormatJSON {
+		line = l.jsonLine(lv, msg, fields)
+	} else {
+		line = l.textLine(lv, msg, fields)
+	}
+
+	out := l.out
+	if lv >= levelError {
+		out = l.errOut
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(out, line+"\n")
+}
+
+// e.g. [INFO]  2006/01/02 15:04:05 written path=/docs/a.md
+func (l *leveledLogger) textLine(lv level, msg string, fields []interface{}) string {
+	var b strings.Builder
+	b.WriteString(levelPrefixes[lv])
+	b.WriteString(l.now().Format("2006/01/02 15:04:05 "))
+	b.WriteString(msg)
+
+	for i := 0; i < len(fields); i += 2 {
+		key, value := fieldAt(fields, i)
+		text := fmt.Sprint(value)
+		if text == "" || strings.ContainsAny(text, " \t\r\n\"=") {
+			text = fmt.Sprintf("%q", text)
+		}
+		fmt.Fprintf(&b, " %s=%s", key, text)
+	}
+	return b.String()
+}
+
+// e.g. {"time":"2006-01-02T15:04:05Z","level":"info","msg":"written","path":"/docs/a.md"}
+func (l *leveledLogger) jsonLine(lv level, msg string, fields []interface{}) string {
+	entry := map[string]interface{}{
+		"time":  l.now().Format(time.RFC3339),
+		"level": levelNames[lv],
+		"msg":   msg,
+	}
+	for i := 0; i < len(fields); i += 2 {
+		key, value := fieldAt(fields, i)
+		switch v := value.(type) {
+		case error:
+			// errors are encoded as empty objects otherwise
+			entry[key] = v.Error()
+		case fmt.Stringer:
+			entry[key] = v.String()
+		default:
+			entry[key] = v
+		}
+	}
+
+	// keys of maps are sorted by encoding/json
+	line, err := json.Marshal(entry)
+	if err != nil {
+		line, _ = json.Marshal(map[string]string{"level": levelNames[lv], "msg": msg, "error": err.Error()})
+	}
+	return string(line)
+}
+
+// key and value of the field starting at i. the value is missing if the
+// number of fields is odd.
+func fieldAt(fields []interface{}, i int) (string, interface{}) {
+	key := fmt.Sprint(fields[i])
+	if i+1 >= len(fields) {
+		return key, nil
+	}
+	return key, fields[i+1]
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLeveledLogger(t *testing.T) {
+	type TestCase struct {
+		min         level
+		format      string
+		expectedOut string
+		expectedErr string
+	}
+
+	testCases := []TestCase{
+		TestCase{
+			levelInfo,
+			logFormatText,
+			"[INFO]  2019/02/03 04:05:06 written path=\"/docs/a b.md\" count=2\n" +
+				"[WARN]  2019/02/03 04:05:06 failed to copy assets path=/docs/a.md\n",
+			"[ERRRR] 2019/02/03 04:05:06 failed path=/docs/b.md error=\"not found\"\n",
+		},
+		// quiet mode
+		TestCase{
+			levelWarn,
+			logFormatJSON,
+			`{"level":"warn","msg":"failed to copy assets","path":"/docs/a.md","time":"2019-02-03T04:05:06Z"}` + "\n",
+			`{"error":"not found","level":"error","msg":"failed","path":"/docs/b.md","time":"2019-02-03T04:05:06Z"}` + "\n",
+		},
+	}
+
+	for i, testCase := range testCases {
+		var out, errOut bytes.Buffer
+		l := newLogger(&out, &errOut, testCase.min, testCase.format)
+		l.now = func() time.Time { return time.Date(2019, 2, 3, 4, 5, 6, 0, time.UTC) }
+
+		l.Debug("option", "out", "dist")
+		l.Info("written", "path", "/docs/a b.md", "count", 2)
+		l.Warn("failed to copy assets", "path", "/docs/a.md")
+		l.Error("failed", "path", "/docs/b.md", "error", errors.New("not found"))
+
+		if out.String() != testCase.expectedOut {
+			t.Errorf("\n%d\ngot %v\nwant %v", i, out.String(), testCase.expectedOut)
+		}
+		if errOut.String() != testCase.expectedErr {
+			t.Errorf("\n%d\ngot %v\nwant %v", i, errOut.String(), testCase.expectedErr)
+		}
+	}
+}
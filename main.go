@@ -6,214 +6,431 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
-	"sync"
+	"sort"
+	"strings"
 	"time"
 
-	"github.com/go-fsnotify/fsnotify"
-	zglob "github.com/mattn/go-zglob"
 	"github.com/pkg/errors"
 	exists "github.com/taq-f/go-exists"
 	"github.com/taq-f/miniature-potato/renderer"
 )
 
-var debugLog *log.Logger
-var infoLog *log.Logger
-var warnLog *log.Logger
-var errLog *log.Logger
-
-func initLogger(verbose bool) {
-	if !verbose {
-		debugLog = log.New(ioutil.Discard, "[DEBUG] ", log.Ldate|log.Ltime)
-	} else {
-		debugLog = log.New(os.Stdout, "[DEBUG] ", log.Ldate|log.Ltime)
+var logger = newLogger(os.Stdout, os.Stderr, levelInfo, logFormatText)
+
+// errors are always written to stderr, and the other messages to out.
+// quiet mode writes only warnings and errors.
+func initLogger(verbose, quiet bool, format string, out io.Writer) {
+	min := levelInfo
+	switch {
+	case quiet:
+		min = levelWarn
+	case verbose:
+		min = levelDebug
 	}
-	infoLog = log.New(os.Stdout, "[INFO]  ", log.Ldate|log.Ltime)
-	warnLog = log.New(os.Stdout, "[WARN]  ", log.Ldate|log.Ltime)
-	errLog = log.New(os.Stdout, "[ERRRR] ", log.Ldate|log.Ltime)
+	logger = newLogger(out, os.Stderr, min, format)
 }
 
 func main() {
-	argOutDir := flag.String("o", "", "Output directory. If not specified, html file will be located in the same directory as the markdown file.")
-	argImageInline := flag.Bool("i", false, "Whether image files are embeded into html file. default: false.")
-	argCustomTemplate := flag.String("t", "", "custom html template file path.")
-	argCustomStyle := flag.String("s", "", "custom stylesheet path")
-	argVerbose := flag.Bool("v", false, "Show details about processing. default false.")
-	argWatch := flag.Bool("w", false, "Watch modification of markdown files and refresh html file as modification. default: false.")
-
+	// flags are applied onto options loaded from configuration files later
+	cli := defaultOptions()
+	cli.bind(flag.CommandLine)
 	flag.Parse()
+	set := setFlags(flag.CommandLine)
 
-	initLogger(*argVerbose)
+	// "-" reads markdown from stdin and writes html to stdout
+	stdin := flag.Arg(0) == stdinPath
 
-	debugLog.Printf("option: out: %s", *argOutDir)
-	debugLog.Printf("option: image inline: %v", *argImageInline)
-	debugLog.Printf("option: template: %v", *argCustomTemplate)
-	debugLog.Printf("option: style sheet: %v", *argCustomStyle)
-	debugLog.Printf("option: watch: %v", *argWatch)
+	// logs must not be mixed into the report nor html
+	logOut := func(opts options) io.Writer {
+		if (opts.Report != "" && opts.ReportFile == "") || stdin {
+			return os.Stderr
+		}
+		return os.Stdout
+	}
+	initLogger(cli.Verbose, cli.Quiet, cli.LogFormat, logOut(cli))
 
 	// input path is specified without flag (as command line arg).
 	argInputPath := ""
 	args := flag.Args()
 	if len(args) >= 1 {
 		argInputPath = args[0]
-		debugLog.Printf("input path specified: %v", argInputPath)
+		logger.Debug("input path specified", "path", argInputPath)
 	} else {
 		crr, err := os.Getwd()
 		if err != nil {
-			log.Fatalf("ERROR: %v", err)
+			logger.Fatal("failed to get current directory", "error", err)
 		}
 		argInputPath = crr
-		debugLog.Printf("input path not specified. current directory is selected: %v", argInputPath)
+		logger.Debug("input path not specified. current directory is selected", "path", argInputPath)
+	}
+
+	// configuration is looked up in the input directory, or the directory of
+	// the input file. directories under it can have their own.
+	configRoot, err := filepath.Abs(argInputPath)
+	if stdin || err != nil {
+		configRoot, err = os.Getwd()
+		if err != nil {
+			logger.Fatal("failed to get current directory", "error", err)
+		}
+	} else if !isDir(configRoot) {
+		configRoot = filepath.Dir(configRoot)
+	}
+
+	opts, overrides, err := loadOptions(configRoot, set, !stdin && isDir(configRoot))
+	if err != nil {
+		logger.Fatal("failed to load configuration", "error", err)
+	}
+
+	initLogger(opts.Verbose, opts.Quiet, opts.LogFormat, logOut(opts))
+	if opts.LogFormat != logFormatText && opts.LogFormat != logFormatJSON {
+		logger.Fatal("unknown log format", "format", opts.LogFormat)
+	}
+
+	logger.Debug("option", "out", opts.OutDir)
+	logger.Debug("option", "image_inline", opts.ImageInline)
+	logger.Debug("option", "template", opts.Template)
+	logger.Debug("option", "style_sheet", opts.Style)
+	logger.Debug("option", "partials", opts.Partials)
+	logger.Debug("option", "engine", opts.Engine)
+	logger.Debug("option", "mermaid_command", opts.MermaidCmd)
+	logger.Debug("option", "plantuml_command", opts.PlantUMLCmd)
+	logger.Debug("option", "plantuml_server", opts.PlantUMLServer)
+	logger.Debug("option", "math", opts.Math)
+	logger.Debug("option", "math_assets", opts.MathAssets)
+	logger.Debug("option", "theme", opts.Theme)
+	logger.Debug("option", "copy_button", opts.CopyButton)
+	logger.Debug("option", "collapse_button", opts.CollapseButton)
+	logger.Debug("option", "toc_min", opts.TOCMin, "toc_max", opts.TOCMax)
+	logger.Debug("option", "jobs", opts.Jobs)
+	logger.Debug("option", "force", opts.Force)
+	logger.Debug("option", "site", opts.Site)
+	logger.Debug("option", "check", opts.Check)
+	logger.Debug("option", "watch", opts.Watch)
+	logger.Debug("option", "serve", opts.Serve)
+	logger.Debug("option", "report", opts.Report)
+	logger.Debug("option", "report_file", opts.ReportFile)
+	logger.Debug("option", "include", opts.Include, "exclude", opts.Exclude)
+	logger.Debug("option", "extensions", opts.Extensions)
+	for dir := range overrides {
+		logger.Debug("configuration of directory", "path", dir)
+	}
+
+	if opts.Report != "" && opts.Report != reportJSON {
+		logger.Fatal("unknown report format", "format", opts.Report)
+	}
+
+	if stdin && (opts.Watch || opts.Serve != "" || opts.Site || opts.Check) {
+		logger.Fatal("stdin cannot be watched, served, built as a site nor checked")
 	}
 
 	// after here, all paths should be considered as absolute path.
-	inputPath, basePath, outPath, err := parsePath(argInputPath, *argOutDir)
+	var inputPath, basePath, outPath string
+	if stdin {
+		// relative paths in markdown are resolved against current directory
+		inputPath, basePath, outPath = stdinPath, configRoot, configRoot
+	} else {
+		var err error
+		inputPath, basePath, outPath, err = parsePath(argInputPath, opts.OutDir)
+		if err != nil {
+			// input, output and base paths are all required.
+			// so no further processing with some error aquiring paths.
+			logger.Fatal("invalid path", "error", err)
+		}
+	}
 
+	logger.Debug("normalized path", "input", inputPath, "base", basePath, "out", outPath)
+
+	rs, err := loadRenderers(opts, overrides, basePath, outPath)
+	if err != nil {
+		logger.Fatal("invalid option", "error", err)
+	}
+	r := rs.root
+
+	if stdin {
+		os.Exit(renderStream(r, os.Stdin, os.Stdout))
+	}
+
+	// files ignored are neither rendered nor watched
+	filter := newFileFilter(basePath, opts.Include, opts.Exclude)
+
+	files, err := getTargetFiles(inputPath, opts.Extensions, filter)
 	if err != nil {
-		// input, output and base paths are all required.
-		// so no further processing with some error aquiring paths.
-		errLog.Fatal(err)
+		logger.Fatal("failed to find target files", "path", inputPath, "error", err)
 	}
 
-	debugLog.Printf("normalized path: input: %v", inputPath)
-	debugLog.Printf("normalized path: base:  %v", basePath)
-	debugLog.Printf("normalized path: out:   %v", outPath)
+	logger.Info("files detected", "count", len(files))
 
-	style := getStyleTag(*argCustomStyle)
-	template := getTemplate(*argCustomTemplate)
+	if opts.Check {
+		os.Exit(check(r, files))
+	}
 
-	debugLog.Print("style tag aquired")
-	debugLog.Print("template html aquired")
+	if opts.Site {
+		if err := r.BuildSite(files); err != nil {
+			logger.Fatal("failed to build site", "error", err)
+		}
+		for _, other := range rs.all()[1:] {
+			other.ShareSite(r)
+		}
+	}
 
-	files, err := getTargetFiles(inputPath)
+	// unchanged files are skipped unless forced, but all rendered files are
+	// recorded so that the next build can skip them.
+	manifest, err := renderer.LoadManifest(outPath)
 	if err != nil {
-		errLog.Fatal("failed to find target files:", err)
+		logger.Warn("manifest is ignored", "error", err)
+	}
+	for _, each := range rs.all() {
+		each.Manifest = manifest
 	}
 
-	infoLog.Printf("%d files detected", len(files))
+	logger.Debug("renderer initialized")
 
-	r := renderer.Renderer{
-		ImageInline: *argImageInline,
-		Template:    template,
-		Style:       style,
-		OutDir:      outPath,
-		BaseDir:     basePath,
+	report := buildReport{}
+	start := time.Now()
+
+	for result := range renderFiles(rs, files, opts.Jobs, opts.Force) {
+		for _, w := range result.warnings {
+			logger.Warn(w, "path", result.file)
+		}
+		switch {
+		case result.skipped:
+			logger.Debug("unchanged", "path", result.file)
+		case result.err != nil:
+			logger.Error("failed", "path", result.file, "error", result.err)
+		default:
+			logger.Info("written", "path", result.file, "output", result.output, "duration", result.duration)
+		}
+		report.add(result)
+	}
+
+	summary := &report.Summary
+	logger.Info("SUMMARY", "all", summary.All, "success", summary.Success, "skipped", summary.Skipped, "fail", summary.Failed)
+
+	if err := manifest.Save(); err != nil {
+		logger.Warn("failed to write manifest", "error", err)
+	}
+
+	if err := r.RenderIndexes(); err != nil {
+		logger.Error("failed to write index pages", "error", err)
+		summary.Errors = append(summary.Errors, err.Error())
 	}
+	summary.DurationMS = milliseconds(time.Since(start))
 
-	debugLog.Print("renderer initialized")
+	if opts.Report != "" {
+		if err := writeReport(&report, opts.ReportFile); err != nil {
+			logger.Fatal("failed to write report", "path", opts.ReportFile, "error", err)
+		}
+	}
 
-	wait := new(sync.WaitGroup)
+	// scripts detect broken builds by exit code
+	failed := summary.Failed > 0 || len(summary.Errors) > 0
 
-	var failed []string
+	var onRender func(string)
 
-	for _, f := range files {
-		wait.Add(1)
-		debugLog.Printf("render job added for %v", f)
-		go func(file string) {
-			err = r.Render(file)
-			if err == nil {
-				infoLog.Printf("written: %s", file)
-			} else {
-				warnLog.Printf("fail   : %s: %s", file, err)
-				failed = append(failed, file)
+	if opts.Serve != "" {
+		broker := newReloadBroker()
+		onRender = broker.notify
+
+		go func() {
+			logger.Info("serving", "dir", r.OutDir, "address", opts.Serve)
+			if err := serve(opts.Serve, r.OutDir, broker); err != nil {
+				logger.Fatal("failed to serve", "address", opts.Serve, "error", err)
 			}
-			wait.Done()
-		}(f)
+		}()
 	}
-	wait.Wait()
 
-	infoLog.Printf("SUMMARY: all %d, success %d, fail %d", len(files), len(files)-len(failed), len(failed))
+	if opts.Watch || opts.Serve != "" {
+		// template, style sheet and partials are read again when one of them
+		// changes or partials are added, and all files are rendered with them
+		reload := func(prev *renderers) (*renderers, error) {
+			next, err := loadRenderers(opts, overrides, basePath, outPath)
+			if err != nil {
+				return nil, err
+			}
+			for _, each := range next.all() {
+				each.Manifest = manifest
+				if opts.Site {
+					each.ShareSite(prev.root)
+				}
+			}
+			return next, nil
+		}
+
+		logger.Info("start watching...")
+		w := &watcher{
+			root:      inputPath,
+			renderers: rs,
+			filter:    filter,
+			assets:    assetFiles(opts, overrides),
+			partials:  partialPatterns(opts, overrides),
+			reload:    reload,
+			onRender:  onRender,
+		}
+		w.run()
+	}
 
-	if *argWatch {
-		infoLog.Println("start watching...")
-		watch(inputPath, &r)
+	if failed {
+		os.Exit(1)
 	}
 }
 
-// watch file modifications and call appropriate renderer actions
-func watch(root string, renderer *renderer.Renderer) {
-	watcher, err := fsnotify.NewWatcher()
+// create renderers of the input root and directories having their own
+// configuration
+func loadRenderers(opts options, overrides map[string]options, basePath, outPath string) (*renderers, error) {
+	root, err := newRenderer(opts, basePath, outPath)
 	if err != nil {
-		errLog.Fatal(err)
-	}
-	defer watcher.Close()
-
-	done := make(chan bool)
-
-	go func() {
-		// when a file is modified (saved), "Write" occurs multiple times in
-		// a very short time. to detect a event is originated from the same
-		// operation, record time of events on the same file.
-		modTimeTable := map[string]int64{}
-
-		for {
-			select {
-			case event := <-watcher.Events:
-				path := event.Name
-				switch {
-				case event.Op&fsnotify.Write == fsnotify.Write:
-					if isTargetFile(path) {
-						now := time.Now().UnixNano()
-						t, exists := modTimeTable[path]
-						var doRender bool
-						if exists {
-							span := now - t
-							if span > (200 * 1000 * 1000) {
-								doRender = true
-								modTimeTable[path] = now
-							}
-						} else {
-							modTimeTable[path] = now
-							doRender = true
-						}
-
-						if doRender {
-							infoLog.Println("modification detected:", path)
-							renderer.Render(path)
-						}
-					}
-				case event.Op&fsnotify.Create == fsnotify.Create:
-					if isTargetFile(path) {
-						infoLog.Println("new file detected:", path)
-						renderer.Render(path)
-					} else if isDir(path) {
-						infoLog.Println("new directory detected:", path)
-						watcher.Add(path)
-					}
-				case event.Op&fsnotify.Remove == fsnotify.Remove:
-					if isDir(path) {
-						watcher.Remove(path)
-					}
-				case event.Op&fsnotify.Rename == fsnotify.Rename:
-					if isDir(path) {
-						watcher.Remove(path)
-					}
-				case event.Op&fsnotify.Chmod == fsnotify.Chmod:
-					// TODO
-				}
-			case err := <-watcher.Errors:
-				errLog.Println("watch error: ", err)
-				done <- true
+		return nil, err
+	}
+
+	rs := newRenderers(root)
+	for dir, o := range overrides {
+		r, err := newRenderer(o, basePath, outPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid configuration of %s", dir)
+		}
+		rs.add(dir, r)
+	}
+	return rs, nil
+}
+
+// create the renderer rendering with the options
+func newRenderer(opts options, basePath, outPath string) (*renderer.Renderer, error) {
+	style, err := getStyleTag(opts.Style)
+	if err != nil {
+		return nil, err
+	}
+	template, err := getTemplate(opts.Template)
+	if err != nil {
+		return nil, err
+	}
+	partials, err := getPartials(opts.Partials)
+	if err != nil {
+		return nil, err
+	}
+
+	codeScript := ""
+	if opts.CopyButton || opts.CollapseButton {
+		style += getAssetTag("style", "/assets/codetools.css")
+		codeScript = getAssetTag("script", "/assets/codetools.js")
+	}
+
+	if opts.Serve != "" {
+		template = injectScript(template, reloadScript)
+	}
+
+	logger.Debug("style tag aquired")
+	logger.Debug("template html aquired")
+
+	engine, err := renderer.NewEngine(opts.Engine)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid engine")
+	}
+	if !renderer.HasTheme(opts.Theme) {
+		return nil, errors.Errorf("unknown theme: %s", opts.Theme)
+	}
+
+	return &renderer.Renderer{
+		ImageInline: opts.ImageInline,
+		Template:    template,
+		Partials:    partials,
+		Style:       style,
+		OutDir:      outPath,
+		BaseDir:     basePath,
+		Engine:      engine,
+		DiagramCommands: map[string]string{
+			"mermaid":  opts.MermaidCmd,
+			"plantuml": opts.PlantUMLCmd,
+		},
+		PlantUMLServer: opts.PlantUMLServer,
+		Theme:          opts.Theme,
+		CopyButton:     opts.CopyButton,
+		CollapseButton: opts.CollapseButton,
+		CodeScript:     codeScript,
+		Math:           opts.Math,
+		MathAssets:     opts.MathAssets,
+		Extensions:     opts.Extensions,
+		TOCMinLevel:    opts.TOCMin,
+		TOCMaxLevel:    opts.TOCMax,
+		Logger:         logger,
+	}, nil
+}
+
+// files read when renderers are created, which are template and style sheet
+func assetFiles(opts options, overrides map[string]options) []string {
+	return absolutePaths(opts, overrides, func(o options) []string {
+		return []string{o.Template, o.Style}
+	})
+}
+
+// glob patterns of partial templates read when renderers are created
+func partialPatterns(opts options, overrides map[string]options) []string {
+	return absolutePaths(opts, overrides, func(o options) []string {
+		return []string{o.Partials}
+	})
+}
+
+// absolute paths given by each options, without duplicates, sorted
+func absolutePaths(opts options, overrides map[string]options, paths func(options) []string) []string {
+	all := []options{opts}
+	for _, o := range overrides {
+		all = append(all, o)
+	}
+
+	seen := map[string]bool{}
+	var files []string
+	for _, o := range all {
+		for _, f := range paths(o) {
+			if f == "" {
+				continue
+			}
+			if abs, err := filepath.Abs(f); err == nil && !seen[abs] {
+				seen[abs] = true
+				files = append(files, abs)
 			}
 		}
-	}()
+	}
+	sort.Strings(files)
+	return files
+}
 
-	for _, p := range getDirectories(root) {
-		err = watcher.Add(p)
-		if err != nil {
-			errLog.Fatal(err)
+// check markdown files and print problems found.
+// returns exit code, which is 1 if any problem is found.
+func check(r *renderer.Renderer, files []string) int {
+	diagnostics, err := r.Check(files)
+	if err != nil {
+		logger.Fatal("failed to check files", "error", err)
+	}
+
+	wd, _ := os.Getwd()
+	for _, d := range diagnostics {
+		// shorter path is easier to read, and editors can jump to it.
+		if rel, err := filepath.Rel(wd, d.Path); err == nil && !strings.HasPrefix(rel, "..") {
+			d.Path = rel
 		}
+		fmt.Println(d)
+	}
+
+	logger.Info("SUMMARY", "all", len(files), "problems", len(diagnostics))
+
+	if len(diagnostics) > 0 {
+		return 1
 	}
+	return 0
+}
 
-	<-done
+// see if the path is the root or under it
+func isUnder(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
 }
 
 // collect markdown files from the path specified.
 // if the path is a file, return only that file.
-// if the path is a directory, return all markdown files under it (recursively).
-func getTargetFiles(path string) ([]string, error) {
+// if the path is a directory, return all markdown files under it (recursively)
+// which have one of the extensions and the filter allows.
+func getTargetFiles(path string, extensions []string, filter *fileFilter) ([]string, error) {
 	if !exists.File(path) {
 		return nil, errors.New("file not found")
 	}
@@ -222,8 +439,22 @@ func getTargetFiles(path string) ([]string, error) {
 		return []string{path}, nil
 	}
 
-	globStr := filepath.Join(path, "**", "*.md")
-	files, err := zglob.Glob(globStr)
+	var files []string
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if !filter.allowDir(p) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if renderer.IsMarkdown(p, extensions) && filter.allowFile(p) {
+			files = append(files, p)
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to get all md files under %s", path)
 	}
@@ -231,12 +462,19 @@ func getTargetFiles(path string) ([]string, error) {
 	return files, nil
 }
 
-// get directories under root specified (recursively)
-func getDirectories(root string) []string {
+// get directories under root specified (recursively) which the filter allows.
+// all directories are returned if the filter is nil.
+func getDirectories(root string, filter *fileFilter) []string {
 	var directories = []string{}
 
 	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
 		if info.IsDir() {
+			if !filter.allowDir(path) {
+				return filepath.SkipDir
+			}
 			directories = append(directories, path)
 		}
 		return nil
@@ -258,12 +496,12 @@ func isDir(path string) bool {
 	return mode.IsDir()
 }
 
-// see if specified path is markdown file
-func isTargetFile(path string) bool {
+// see if specified path is markdown file, which has one of the extensions
+func isTargetFile(path string, extensions []string) bool {
 	if isDir(path) {
 		return false
 	}
-	return filepath.Ext(path) == ".md"
+	return renderer.IsMarkdown(path, extensions)
 }
 
 // get directory paths
@@ -342,35 +580,53 @@ func parsePath(input, output string) (inputPath, basePath, outPath string, err e
 }
 
 // create html template string
-func getTemplate(custom string) string {
+func getTemplate(custom string) (string, error) {
 	if custom != "" {
 		content, err := ioutil.ReadFile(custom)
 		if err != nil {
-			// user specified css file must exist.
-			errLog.Fatalf("could not open template: %s: %v", custom, err)
+			// user specified template file must exist.
+			return "", errors.Wrapf(err, "could not open template %s", custom)
 		}
-		return string(content)
+		return string(content), nil
 	}
 
-	return readAssets("/assets/template.html")
+	return readAssets("/assets/template.html"), nil
+}
+
+// get partial template files matching the pattern
+func getPartials(pattern string) ([]string, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+
+	partials, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid partial template pattern %s", pattern)
+	}
+	return partials, nil
 }
 
 // create style tag string
-func getStyleTag(custom string) string {
+func getStyleTag(custom string) (string, error) {
 	style := ""
 
 	if custom != "" {
 		content, err := ioutil.ReadFile(custom)
 		if err != nil {
 			// user specified css file must exist.
-			errLog.Fatalf("could not open style sheet: %s: %v", custom, err)
+			return "", errors.Wrapf(err, "could not open style sheet %s", custom)
 		}
 		style = string(content)
 	} else {
 		style = readAssets("/assets/default.css")
 	}
 
-	return "\n<style>\n" + style + "\n</style>\n"
+	return "\n<style>\n" + style + "\n</style>\n", nil
+}
+
+// get the asset wrapped in the tag, such as style and script
+func getAssetTag(tag, path string) string {
+	return "\n<" + tag + ">\n" + readAssets(path) + "\n</" + tag + ">\n"
 }
 
 // read assets
@@ -378,7 +634,7 @@ func readAssets(path string) (content string) {
 	file, err := Assets.Open(path)
 	if err != nil {
 		// assets must exist since they are not something user freely specifies.
-		errLog.Fatalf("failed to read asset: %s: %v", path, err)
+		logger.Fatal("failed to read asset", "path", path, "error", err)
 	}
 	by := new(bytes.Buffer)
 	io.Copy(by, file)
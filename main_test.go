@@ -1,8 +1,10 @@
 package main
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -115,3 +117,50 @@ func TestIsDirFalse(t *testing.T) {
 		t.Errorf("isDir returned true while the path points to a file: %v", testDirPath)
 	}
 }
+
+func TestGetTargetFilesExtensions(t *testing.T) {
+	root, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, name := range []string{"README.MD", "a.md", "b.markdown", "c.mdown", "d.mkd", "e.txt", "f.md.bak"} {
+		ioutil.WriteFile(filepath.Join(root, name), []byte("# "+name+"\n"), 0644)
+	}
+	os.Mkdir(filepath.Join(root, "dir.md"), 0755)
+
+	type TestCase struct {
+		extensions []string
+		expected   string
+	}
+
+	testCases := []TestCase{
+		TestCase{nil, "README.MD,a.md,b.markdown,c.mdown,d.mkd"},
+		TestCase{[]string{".md", "txt"}, "README.MD,a.md,e.txt"},
+	}
+
+	for i, testCase := range testCases {
+		files, err := getTargetFiles(root, testCase.extensions, nil)
+		if err != nil {
+			t.Errorf("\n%d\nunexpected error: %v", i, err)
+			continue
+		}
+
+		var names []string
+		for _, f := range files {
+			// watch finds the same files as the initial scan
+			if !isTargetFile(f, testCase.extensions) {
+				t.Errorf("\n%d\nisTargetFile returned false for %v", i, f)
+			}
+			names = append(names, filepath.Base(f))
+		}
+		if strings.Join(names, ",") != testCase.expected {
+			t.Errorf("\n%d\ngot %v\nwant %v", i, strings.Join(names, ","), testCase.expected)
+		}
+	}
+
+	if isTargetFile(filepath.Join(root, "dir.md"), nil) {
+		t.Error("isTargetFile returned true for a directory")
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/taq-f/miniature-potato/renderer"
+)
+
+// input path meaning markdown is read from stdin, and html is written to stdout
+const stdinPath = "-"
+
+// render markdown read from in into html written to out. returns exit code.
+func renderStream(r *renderer.Renderer, in io.Reader, out io.Writer) int {
+	if err := r.RenderTo(context.Background(), out, in, renderer.Options{}); err != nil {
+		logger.Error("failed", "path", stdinPath, "error", err)
+		return 1
+	}
+	return 0
+}
+
+// renderers holds the renderer of the input root, and renderers of
+// directories having their own configuration, which render files in their
+// subtrees.
+type renderers struct {
+	root *renderer.Renderer
+	// directories with their own configuration, deeper first
+	dirs  []string
+	byDir map[string]*renderer.Renderer
+}
+
+func newRenderers(root *renderer.Renderer) *renderers {
+	return &renderers{root: root, byDir: map[string]*renderer.Renderer{}}
+}
+
+// add the renderer of files under the directory
+func (rs *renderers) add(dir string, r *renderer.Renderer) {
+	rs.byDir[dir] = r
+	rs.dirs = append(rs.dirs, dir)
+	sort.Slice(rs.dirs, func(i, j int) bool {
+		return len(rs.dirs[i]) > len(rs.dirs[j])
+	})
+}
+
+// get the renderer of the file, which is the one of the nearest directory
+func (rs *renderers) forFile(path string) *renderer.Renderer {
+	for _, dir := range rs.dirs {
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return rs.byDir[dir]
+		}
+	}
+	return rs.root
+}
+
+// all renderers, the root first
+func (rs *renderers) all() []*renderer.Renderer {
+	all := []*renderer.Renderer{rs.root}
+	for _, dir := range rs.dirs {
+		all = append(all, rs.byDir[dir])
+	}
+	return all
+}
+
+// Dependents returns documents including the file, rendered by any renderer.
+func (rs *renderers) Dependents(path string) []string {
+	var dependents []string
+	for _, r := range rs.all() {
+		dependents = append(dependents, r.Dependents(path)...)
+	}
+	sort.Strings(dependents)
+	return dependents
+}
+
+// Includes returns files included by any document.
+func (rs *renderers) Includes() []string {
+	var includes []string
+	for _, r := range rs.all() {
+		includes = append(includes, r.Includes()...)
+	}
+	sort.Strings(includes)
+	return includes
+}
+
+// result of rendering a markdown file
+type renderResult struct {
+	file string
+	// whether rendering is skipped since the file is unchanged
+	skipped  bool
+	output   string
+	warnings []string
+	duration time.Duration
+	err      error
+}
+
+// render files by the number of workers. results are sent in the order of
+// completion, and the channel is closed when all files are processed.
+// unchanged files are skipped unless force is true. files rendered into the
+// same html as a former file, such as a.markdown and a.md, fail.
+func renderFiles(rs *renderers, files []string, workers int, force bool) <-chan renderResult {
+	if workers < 1 {
+		workers = 1
+	}
+
+	files, duplicates := uniqueOutputs(rs, files)
+
+	jobs := make(chan string)
+	results := make(chan renderResult)
+
+	go func() {
+		for _, f := range files {
+			jobs <- f
+		}
+		close(jobs)
+	}()
+
+	wait := new(sync.WaitGroup)
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		for _, d := range duplicates {
+			results <- d
+		}
+	}()
+	for i := 0; i < workers; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for file := range jobs {
+				r := rs.forFile(file)
+				start := time.Now()
+				if !force && r.UpToDate(file) {
+					results <- renderResult{file: file, skipped: true, output: r.OutputPath(file), duration: time.Since(start)}
+					continue
+				}
+				result, err := r.RenderFile(context.Background(), file)
+				results <- renderResult{
+					file:     file,
+					output:   result.Output,
+					warnings: result.Warnings,
+					duration: time.Since(start),
+					err:      err,
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wait.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// split files into the ones rendered into distinct html files, and failed
+// results of the ones whose html is the same as a former file. paths are
+// compared ignoring case, since they are the same file on windows.
+func uniqueOutputs(rs *renderers, files []string) ([]string, []renderResult) {
+	var unique []string
+	var duplicates []renderResult
+	rendered := map[string]string{}
+
+	for _, f := range files {
+		output := rs.forFile(f).OutputPath(f)
+		key := strings.ToLower(output)
+		if first, ok := rendered[key]; ok {
+			duplicates = append(duplicates, renderResult{
+				file:   f,
+				output: output,
+				err:    errors.Errorf("%s is also rendered from %s", output, first),
+			})
+			continue
+		}
+		rendered[key] = f
+		unique = append(unique, f)
+	}
+
+	return unique, duplicates
+}
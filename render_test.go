@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/taq-f/miniature-potato/renderer"
+)
+
+func TestRenderFiles(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	var files []string
+	for _, name := range []string{"a.md", "b.md", "c.md", "d.md", "e.md"} {
+		file := filepath.Join(baseDir, name)
+		ioutil.WriteFile(file, []byte("# "+name+"\n"), 0644)
+		files = append(files, file)
+	}
+	files = append(files, filepath.Join(baseDir, "missing.md"))
+
+	r := renderer.Renderer{Template: "{{{content}}}", BaseDir: baseDir, OutDir: baseDir}
+
+	var rendered, failed []string
+	for result := range renderFiles(newRenderers(&r), files, 2, false) {
+		if result.err != nil {
+			failed = append(failed, filepath.Base(result.file))
+		} else {
+			rendered = append(rendered, filepath.Base(result.file))
+		}
+	}
+	sort.Strings(rendered)
+
+	if strings.Join(rendered, ",") != "a.md,b.md,c.md,d.md,e.md" {
+		t.Errorf("\ngot %v\nwant %v", rendered, "a.md,b.md,c.md,d.md,e.md")
+	}
+	if strings.Join(failed, ",") != "missing.md" {
+		t.Errorf("\ngot %v\nwant %v", failed, "missing.md")
+	}
+}
+
+func TestRenderFilesDuplicateOutput(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	var files []string
+	for _, name := range []string{"a.markdown", "a.md", "A.mkd", "b.md"} {
+		file := filepath.Join(baseDir, name)
+		ioutil.WriteFile(file, []byte("# "+name+"\n"), 0644)
+		files = append(files, file)
+	}
+
+	r := renderer.Renderer{Template: "{{{content}}}", BaseDir: baseDir, OutDir: baseDir}
+
+	var rendered, failed []string
+	for result := range renderFiles(newRenderers(&r), files, 2, false) {
+		if result.err != nil {
+			failed = append(failed, filepath.Base(result.file))
+		} else {
+			rendered = append(rendered, filepath.Base(result.file))
+		}
+	}
+	sort.Strings(rendered)
+
+	// the first file is rendered, and the others writing a.html fail
+	if strings.Join(rendered, ",") != "a.markdown,b.md" {
+		t.Errorf("\ngot %v\nwant %v", rendered, "a.markdown,b.md")
+	}
+	sort.Strings(failed)
+	if strings.Join(failed, ",") != "A.mkd,a.md" {
+		t.Errorf("\ngot %v\nwant %v", failed, "A.mkd,a.md")
+	}
+
+	content, _ := ioutil.ReadFile(filepath.Join(baseDir, "a.html"))
+	if !strings.Contains(string(content), "a.markdown") {
+		t.Errorf("a.html is not rendered from a.markdown: %s", content)
+	}
+}
+
+func TestRenderFilesSkipped(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	file := filepath.Join(baseDir, "a.md")
+	ioutil.WriteFile(file, []byte("# a\n"), 0644)
+
+	manifest, _ := renderer.LoadManifest(baseDir)
+	r := renderer.Renderer{Template: "{{{content}}}", BaseDir: baseDir, OutDir: baseDir, Manifest: manifest}
+
+	type TestCase struct {
+		force    bool
+		expected bool
+	}
+
+	// the file is rendered the first time and when forced
+	testCases := []TestCase{
+		TestCase{false, false},
+		TestCase{false, true},
+		TestCase{true, false},
+	}
+
+	for i, testCase := range testCases {
+		for result := range renderFiles(newRenderers(&r), []string{file}, 0, testCase.force) {
+			if result.err != nil || result.skipped != testCase.expected {
+				t.Errorf("\n%d\ngot %+v\nwant skipped %v", i, result, testCase.expected)
+			}
+		}
+	}
+}
+
+func TestRenderStream(t *testing.T) {
+	r := renderer.Renderer{Template: "<title>{{{title}}}</title>\n{{{content}}}"}
+
+	var out bytes.Buffer
+	code := renderStream(&r, strings.NewReader("---\ntitle: Memo\n---\n*text*\n"), &out)
+	if code != 0 {
+		t.Errorf("\ngot %v\nwant %v", code, 0)
+	}
+
+	expected := "<title>Memo</title>\n<p><em>text</em></p>\n"
+	if out.String() != expected {
+		t.Errorf("\ngot %q\nwant %q", out.String(), expected)
+	}
+}
@@ -0,0 +1,287 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+)
+
+// Diagnostic is a problem found in a markdown file.
+type Diagnostic struct {
+	// markdown file
+	Path string
+	// line number, starting from 1
+	Line int
+	// description of the problem
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d: %s", d.Path, d.Line, d.Message)
+}
+
+// reference to another file or anchor in markdown source
+type reference struct {
+	line  int
+	url   string
+	image bool
+}
+
+var (
+	// target of inline links and images, e.g. ](path/to/file.md "title")
+	inlineLinkPattern = regexp.MustCompile(`\]\(\s*<?([^)\s>]+)>?(?:\s+(?:"[^"]*"|'[^']*'|\([^)]*\)))?\s*\)`)
+	// link reference definition, e.g. [id]: path/to/file.md
+	referenceDefinitionPattern = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:\s*<?([^\s>]+)>?`)
+	// links and images written in html
+	htmlLinkPattern = regexp.MustCompile(`(?i)<(a|img)\b[^>]*?\s(?:href|src)\s*=\s*["']([^"']+)["']`)
+	// code span, whose contents are not links
+	codeSpanPattern = regexp.MustCompile("`+[^`]*`+")
+)
+
+// Check validates relative links, anchors and images in the markdown files
+// and the files they include, and returns problems found.
+func (r *Renderer) Check(files []string) ([]Diagnostic, error) {
+	// anchors of markdown files, which are loaded as needed
+	anchors := map[string]map[string]bool{}
+	anchorsOf := func(path string) (map[string]bool, error) {
+		if a, ok := anchors[path]; ok {
+			return a, nil
+		}
+		a, err := r.anchors(path)
+		if err != nil {
+			return nil, err
+		}
+		anchors[path] = a
+		return a, nil
+	}
+
+	var diagnostics []Diagnostic
+
+	for _, path := range files {
+		// references in included files are checked as a part of the
+		// document. relative links in them are relative to the included
+		// files, and anchors in the same page are the ones of the document.
+		for _, source := range append([]string{path}, r.includedMarkdown(path)...) {
+			found, err := r.checkReferences(source, path, anchorsOf)
+			if err != nil {
+				return nil, err
+			}
+			diagnostics = append(diagnostics, found...)
+		}
+	}
+
+	return diagnostics, nil
+}
+
+// check references in the markdown file source, which is a part of the
+// document at path.
+func (r *Renderer) checkReferences(source, path string, anchorsOf func(string) (map[string]bool, error)) ([]Diagnostic, error) {
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", source)
+	}
+
+	var diagnostics []Diagnostic
+	for _, ref := range scanReferences(data) {
+		report := func(format string, args ...interface{}) {
+			message := fmt.Sprintf(format, args...)
+			if source != path {
+				message += fmt.Sprintf(" (included from %s)", path)
+			}
+			diagnostics = append(diagnostics, Diagnostic{
+				Path:    source,
+				Line:    ref.line,
+				Message: message,
+			})
+		}
+
+		linkPath, suffix := splitURL(ref.url)
+		fragment := ""
+		if i := strings.Index(suffix, "#"); i >= 0 {
+			fragment, _ = url.PathUnescape(suffix[i+1:])
+		}
+
+		target := path
+		if linkPath != "" {
+			if !isRelativeLink(linkPath) {
+				continue
+			}
+			unescaped, err := url.PathUnescape(linkPath)
+			if err != nil {
+				report("invalid link: %s", ref.url)
+				continue
+			}
+			target = filepath.Join(filepath.Dir(source), filepath.FromSlash(unescaped))
+
+			if _, err := os.Stat(target); err != nil {
+				if ref.image {
+					report("image not found: %s", ref.url)
+				} else {
+					report("link target not found: %s", ref.url)
+				}
+				continue
+			}
+		}
+
+		if fragment == "" || !r.isMarkdown(target) {
+			continue
+		}
+		a, err := anchorsOf(target)
+		if err != nil {
+			return nil, err
+		}
+		if !a[fragment] {
+			report("anchor not found: %s", ref.url)
+		}
+	}
+
+	return diagnostics, nil
+}
+
+// collect ids in html rendered from the markdown file, which can be used as
+// url fragments.
+func (r *Renderer) anchors(path string) (map[string]bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	_, body, err := parseFrontMatter(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse front matter of %s", path)
+	}
+	// headings may come from included files. includes which fail are
+	// reported when the document is rendered.
+	if expanded, _, err := expandIncludes(path, body, nil); err == nil {
+		body = expanded
+	}
+
+	doc, err := r.markdown(body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse markdown contents of %s", path)
+	}
+	assignHeadingIDs(doc)
+
+	anchors := map[string]bool{}
+	doc.Find("[id], a[name]").Each(func(i int, s *goquery.Selection) {
+		if id, ok := s.Attr("id"); ok {
+			anchors[id] = true
+		}
+		if name, ok := s.Attr("name"); ok {
+			anchors[name] = true
+		}
+	})
+
+	return anchors, nil
+}
+
+// markdown files included into the document directly or indirectly
+func (r *Renderer) includedMarkdown(path string) []string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	_, body, err := parseFrontMatter(data)
+	if err != nil {
+		return nil
+	}
+
+	// files included before a failure are still checked
+	_, included, _ := expandIncludes(path, body, nil)
+
+	seen := map[string]bool{path: true}
+	var files []string
+	for _, f := range included {
+		if seen[f] || !r.isMarkdown(f) {
+			continue
+		}
+		if _, err := os.Stat(f); err == nil {
+			seen[f] = true
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// find links and images in markdown source with their line numbers.
+// front matter and code blocks are skipped.
+func scanReferences(data []byte) []reference {
+	_, body, err := parseFrontMatter(data)
+	if err != nil {
+		body = data
+	}
+	line := bytes.Count(data[:len(data)-len(body)], []byte("\n"))
+
+	var refs []reference
+	fence := ""
+	for len(body) > 0 {
+		var text []byte
+		text, body = splitLine(body)
+		line++
+
+		trimmed := strings.TrimSpace(string(text))
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+		if strings.HasPrefix(string(text), "    ") || strings.HasPrefix(string(text), "\t") {
+			// indented code block
+			continue
+		}
+
+		s := codeSpanPattern.ReplaceAllStringFunc(string(text), func(code string) string {
+			return strings.Repeat(" ", len(code))
+		})
+
+		for _, m := range inlineLinkPattern.FindAllStringSubmatchIndex(s, -1) {
+			refs = append(refs, reference{
+				line:  line,
+				url:   s[m[2]:m[3]],
+				image: isImageLink(s, m[0]),
+			})
+		}
+		if m := referenceDefinitionPattern.FindStringSubmatch(s); m != nil {
+			refs = append(refs, reference{line: line, url: m[1]})
+		}
+		for _, m := range htmlLinkPattern.FindAllStringSubmatch(s, -1) {
+			refs = append(refs, reference{
+				line:  line,
+				url:   m[2],
+				image: strings.ToLower(m[1]) == "img",
+			})
+		}
+	}
+
+	return refs
+}
+
+// see if the link whose text ends at the closing bracket at end is an image
+func isImageLink(s string, end int) bool {
+	depth := 0
+	for i := end; i >= 0; i-- {
+		switch s[i] {
+		case ']':
+			depth++
+		case '[':
+			depth--
+			if depth == 0 {
+				return i > 0 && s[i-1] == '!'
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package renderer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestScanReferences(t *testing.T) {
+	src := "---\ntitle: refs\n---\n" +
+		"See [guide](guide.md#install) and ![logo](img/logo.png \"Logo\").\n" +
+		"[![badge](badge.svg)](https://example.com)\n" +
+		"`[not](a-link.md)`\n" +
+		"```\n[not](a-link.md)\n```\n" +
+		"[ref]: other.md\n" +
+		"<img src=\"img/raw.png\"> <a href='#top'>top</a>\n"
+
+	got := scanReferences([]byte(src))
+	expected := []reference{
+		reference{4, "guide.md#install", false},
+		reference{4, "img/logo.png", true},
+		reference{5, "badge.svg", true},
+		reference{5, "https://example.com", false},
+		reference{10, "other.md", false},
+		reference{11, "img/raw.png", true},
+		reference{11, "#top", false},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("\ngot %v\nwant %v", got, expected)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	index := filepath.Join(baseDir, "index.md")
+	guide := filepath.Join(baseDir, "guide.md")
+	ioutil.WriteFile(index, []byte("# Index\n"+
+		"[ok](guide.md#install-guide)\n"+
+		"[bad anchor](guide.md#missing)\n"+
+		"[missing](nowhere.md)\n"+
+		"![missing](img/none.png)\n"+
+		"[self](#index)\n"+
+		"[external](https://example.com/none.md)\n"), 0644)
+	ioutil.WriteFile(guide, []byte("## Install Guide\n"), 0644)
+
+	r := Renderer{BaseDir: baseDir, OutDir: baseDir}
+	diagnostics, err := r.Check([]string{index, guide})
+	if err != nil {
+		t.Fatalf("Check unexpectedly gave an error: %v", err)
+	}
+
+	expected := []Diagnostic{
+		Diagnostic{index, 3, "anchor not found: guide.md#missing"},
+		Diagnostic{index, 4, "link target not found: nowhere.md"},
+		Diagnostic{index, 5, "image not found: img/none.png"},
+	}
+	if !reflect.DeepEqual(diagnostics, expected) {
+		t.Errorf("\ngot %v\nwant %v", diagnostics, expected)
+	}
+}
+
+func TestCheckIncludes(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	os.MkdirAll(filepath.Join(baseDir, "common"), 0755)
+	doc := filepath.Join(baseDir, "doc.md")
+	part := filepath.Join(baseDir, "common", "part.md")
+	ioutil.WriteFile(doc, []byte("# Doc\n"+
+		"[jump](#shared-section)\n"+
+		"{{< include \"common/part.md\" >}}\n"), 0644)
+	ioutil.WriteFile(part, []byte("## Shared Section\n"+
+		"![logo](logo.png)\n"+
+		"[top](#doc)\n"+
+		"![missing](none.png)\n"), 0644)
+	ioutil.WriteFile(filepath.Join(baseDir, "common", "logo.png"), []byte("png"), 0644)
+
+	r := Renderer{BaseDir: baseDir, OutDir: baseDir}
+	diagnostics, err := r.Check([]string{doc})
+	if err != nil {
+		t.Fatalf("Check unexpectedly gave an error: %v", err)
+	}
+
+	// headings of included files are anchors of the document, and links in
+	// included files are relative to them
+	expected := []Diagnostic{
+		Diagnostic{part, 4, "image not found: none.png (included from " + doc + ")"},
+	}
+	if !reflect.DeepEqual(diagnostics, expected) {
+		t.Errorf("\ngot %v\nwant %v", diagnostics, expected)
+	}
+}
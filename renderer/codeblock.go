@@ -0,0 +1,151 @@
+package renderer
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// first line put into fenced code blocks to carry options written in their
+// info strings through markdown engines, which drop them.
+const codeOptionsMarker = "markdowner-code-options:"
+
+var (
+	// opening fence with options, e.g. ```go {linenos=true hl_lines="3-5"}
+	fenceOptionsPattern = regexp.MustCompile("^(\\s*)(`{3,}|~{3,})([^`{]*?)\\s*\\{([^}]*)\\}\\s*$")
+	// an option in braces, e.g. title="main.go". options are separated by
+	// spaces or commas, so values including them need to be quoted.
+	codeOptionPattern = regexp.MustCompile(`([\w-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s,]+))`)
+)
+
+// options of a fenced code block
+type codeOptions struct {
+	// whether line numbers are shown
+	lineNumbers bool
+	// number of the first line
+	lineNumberStart int
+	// ranges of lines highlighted, in line numbers shown
+	highlightLines [][2]int
+	// caption shown above the block
+	title string
+}
+
+// move options in info strings of fenced code blocks into the first line of
+// their contents, so that they can be read after markdown is converted.
+func extractCodeOptions(data []byte) []byte {
+	var out bytes.Buffer
+
+	fence := ""
+	for len(data) > 0 {
+		line, rest := splitLine(data)
+		raw := data[:len(data)-len(rest)]
+		data = rest
+
+		trimmed := strings.TrimSpace(string(line))
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			out.Write(raw)
+			continue
+		}
+
+		m := fenceOptionsPattern.FindStringSubmatch(string(line))
+		if m == nil {
+			if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+				fence = trimmed[:3]
+			}
+			out.Write(raw)
+			continue
+		}
+
+		indent, marker, lang, options := m[1], m[2], strings.TrimSpace(m[3]), m[4]
+		fence = marker[:3]
+		out.WriteString(indent + marker + lang + "\n")
+		out.WriteString(indent + codeOptionsMarker + options + "\n")
+	}
+
+	return out.Bytes()
+}
+
+// take options out of the first line of code blocks, and keep them in
+// data-options attribute of code elements.
+func takeCodeOptions(doc *goquery.Document) {
+	doc.Find("pre > code").Each(func(i int, s *goquery.Selection) {
+		text := s.Text()
+		if !strings.HasPrefix(text, codeOptionsMarker) {
+			return
+		}
+
+		options, code := splitLine([]byte(text))
+		s.SetText(string(code))
+		s.SetAttr("data-options", strings.TrimPrefix(string(options), codeOptionsMarker))
+	})
+}
+
+// parse options such as `linenos=true hl_lines="3-5 8" title="main.go"`
+func parseCodeOptions(text string) codeOptions {
+	options := codeOptions{lineNumberStart: 1}
+
+	for _, m := range codeOptionPattern.FindAllStringSubmatch(text, -1) {
+		value := m[2] + m[3] + m[4]
+
+		switch strings.ToLower(m[1]) {
+		case "linenos":
+			options.lineNumbers = value != "false" && value != ""
+		case "linenostart":
+			if n, err := strconv.Atoi(value); err == nil {
+				options.lineNumberStart = n
+			}
+		case "hl_lines":
+			options.highlightLines = parseLineRanges(value)
+		case "title":
+			options.title = value
+		}
+	}
+
+	return options
+}
+
+// parse line ranges such as "3-5 8" or "3-5,8"
+func parseLineRanges(text string) [][2]int {
+	var ranges [][2]int
+
+	fields := strings.FieldsFunc(text, func(c rune) bool { return c == ' ' || c == ',' })
+	for _, field := range fields {
+		bounds := strings.SplitN(field, "-", 2)
+		from, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			continue
+		}
+		to := from
+		if len(bounds) == 2 {
+			if to, err = strconv.Atoi(bounds[1]); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, [2]int{from, to})
+	}
+
+	return ranges
+}
+
+// mark code blocks to have buttons, which the code script adds in browsers.
+// returns whether any code block is marked.
+func (r *Renderer) decorateCode(doc *goquery.Document) bool {
+	if !r.CopyButton && !r.CollapseButton {
+		return false
+	}
+
+	blocks := doc.Find("pre")
+	if r.CopyButton {
+		blocks.SetAttr("data-copy", "")
+	}
+	if r.CollapseButton {
+		blocks.SetAttr("data-collapse", "")
+	}
+	return blocks.Length() > 0
+}
@@ -0,0 +1,145 @@
+package renderer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestExtractCodeOptions(t *testing.T) {
+	type TestCase struct {
+		markdown string
+		expected string
+	}
+
+	testCases := []TestCase{
+		TestCase{
+			"```go {linenos=true title=\"main.go\"}\nfunc main() {}\n```\n",
+			"```go\n" + codeOptionsMarker + "linenos=true title=\"main.go\"\nfunc main() {}\n```\n",
+		},
+		// fence in a list keeps its indentation
+		TestCase{
+			"- item\n\n  ~~~ {hl_lines=2}\n  a\n  b\n  ~~~\n",
+			"- item\n\n  ~~~\n  " + codeOptionsMarker + "hl_lines=2\n  a\n  b\n  ~~~\n",
+		},
+		// fences without options and braces inside code are left as they are
+		TestCase{
+			"```go\nfunc main() {}\n```\n",
+			"```go\nfunc main() {}\n```\n",
+		},
+		TestCase{
+			"````\n```go {linenos=true}\n````\n",
+			"````\n```go {linenos=true}\n````\n",
+		},
+	}
+
+	for i, testCase := range testCases {
+		actual := string(extractCodeOptions([]byte(testCase.markdown)))
+		if actual != testCase.expected {
+			t.Errorf("\n%d\ngot %q\nwant %q", i, actual, testCase.expected)
+		}
+	}
+}
+
+func TestParseCodeOptions(t *testing.T) {
+	type TestCase struct {
+		text     string
+		expected codeOptions
+	}
+
+	testCases := []TestCase{
+		TestCase{"", codeOptions{lineNumberStart: 1}},
+		TestCase{
+			`linenos=true linenostart=10 hl_lines="3-5 8" title="main.go"`,
+			codeOptions{true, 10, [][2]int{{3, 5}, {8, 8}}, "main.go"},
+		},
+		TestCase{
+			`linenos=false, hl_lines=2,4-5, title='a b'`,
+			codeOptions{false, 1, [][2]int{{2, 2}}, "a b"},
+		},
+	}
+
+	for i, testCase := range testCases {
+		actual := parseCodeOptions(testCase.text)
+		if !reflect.DeepEqual(actual, testCase.expected) {
+			t.Errorf("\n%d\ngot %v\nwant %v", i, actual, testCase.expected)
+		}
+	}
+}
+
+func TestCodeBlockOptions(t *testing.T) {
+	markdown := "```go {linenos=true linenostart=3 hl_lines=\"4\" title=\"<main.go>\"}\npackage main\nfunc main() {}\n```\n"
+
+	for _, name := range []string{EngineBlackfriday, EngineCommonMark} {
+		engine, _ := NewEngine(name)
+		r := Renderer{Engine: engine}
+
+		doc, err := r.markdown([]byte(markdown))
+		if err != nil {
+			t.Fatalf("markdown unexpectedly gave an error: %v", err)
+		}
+		r.highlightCode(doc, &warnings{})
+
+		if strings.Contains(doc.Text(), codeOptionsMarker) {
+			t.Errorf("%s: options are left in code", name)
+		}
+		if title := doc.Find("div.code-block > div.code-title").Text(); title != "<main.go>" {
+			t.Errorf("%s: \ngot %v\nwant %v", name, title, "<main.go>")
+		}
+
+		numbers := doc.Find("pre.chroma .ln").Map(func(i int, s *goquery.Selection) string {
+			return strings.TrimSpace(s.Text())
+		})
+		if strings.Join(numbers, ",") != "3,4" {
+			t.Errorf("%s: \ngot %v\nwant %v", name, numbers, "3,4")
+		}
+
+		highlighted := strings.TrimSpace(doc.Find("pre.chroma .hl").Text())
+		if !strings.HasPrefix(highlighted, "4") || !strings.Contains(highlighted, "func main") {
+			t.Errorf("%s: unexpected highlighted line: %q", name, highlighted)
+		}
+	}
+}
+
+func TestDecorateCode(t *testing.T) {
+	src := `<pre><code>a</code></pre><p><code>b</code></p><pre><code>c</code></pre>`
+
+	type TestCase struct {
+		copyButton     bool
+		collapseButton bool
+		expected       string
+	}
+
+	testCases := []TestCase{
+		TestCase{false, false, `<pre><code>a</code></pre>`},
+		TestCase{true, false, `<pre data-copy=""><code>a</code></pre>`},
+		TestCase{true, true, `<pre data-copy="" data-collapse=""><code>a</code></pre>`},
+	}
+
+	for i, testCase := range testCases {
+		doc, _ := goquery.NewDocumentFromReader(strings.NewReader(src))
+		r := Renderer{CopyButton: testCase.copyButton, CollapseButton: testCase.collapseButton}
+
+		decorated := r.decorateCode(doc)
+		if decorated != (testCase.copyButton || testCase.collapseButton) {
+			t.Errorf("\n%d decorateCode returned %v", i, decorated)
+		}
+
+		actual, _ := goquery.OuterHtml(doc.Find("pre").First())
+		if actual != testCase.expected {
+			t.Errorf("\n%d\ngot %v\nwant %v", i, actual, testCase.expected)
+		}
+		if doc.Find("p code[data-copy]").Length() > 0 {
+			t.Errorf("\n%d inline code is decorated", i)
+		}
+	}
+
+	// pages without code blocks do not need the script
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(`<p>text</p>`))
+	r := Renderer{CopyButton: true}
+	if r.decorateCode(doc) {
+		t.Error("decorateCode returned true for the page without code blocks")
+	}
+}
@@ -0,0 +1,195 @@
+package renderer
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+)
+
+// languages of fenced code blocks rendered as diagrams
+const (
+	diagramMermaid  = "mermaid"
+	diagramPlantUML = "plantuml"
+)
+
+// time allowed for a diagram command to render a diagram
+const diagramTimeout = 30 * time.Second
+
+// mermaid loaded from CDN, pinned so that diagrams render the same by builds
+const mermaidCDN = "https://cdn.jsdelivr.net/npm/mermaid@10.9.1/dist"
+
+// scripts rendering mermaid diagrams in browsers
+const mermaidScript = `<script src="` + mermaidCDN + `/mermaid.min.js"></script>
+<script>mermaid.initialize({startOnLoad: true});</script>
+`
+
+// characters used by PlantUML to encode diagram source into url
+const plantUMLAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz-_"
+
+var plantUMLEncoding = base64.NewEncoding(plantUMLAlphabet).WithPadding(base64.NoPadding)
+
+// xml declaration and doctype, which are not allowed inside html
+var svgPrologPattern = regexp.MustCompile(`(?s)^\s*(<\?xml.*?\?>\s*)?(<!DOCTYPE[^>]*>\s*)?`)
+
+// render fenced code blocks of diagram languages as diagrams.
+//
+// if a command is configured for the language, it is run with the diagram
+// source as standard input, and svg written to standard output is inlined.
+// otherwise diagrams are rendered in browsers. PlantUML diagrams are sent to
+// the server only if it is configured, and left as code blocks if not.
+// returns scripts the page needs to render them.
+func (r *Renderer) renderDiagrams(ctx context.Context, doc *goquery.Document, w *warnings) string {
+	needMermaid := false
+
+	doc.Find("pre > code[class*=\"language-\"]").Each(func(i int, s *goquery.Selection) {
+		lang := codeLanguage(s)
+		if lang != diagramMermaid && lang != diagramPlantUML {
+			return
+		}
+		source := s.Text()
+
+		if command := r.DiagramCommands[lang]; command != "" {
+			svg, err := runDiagramCommand(ctx, command, source)
+			if err == nil {
+				s.Parent().ReplaceWithHtml(fmt.Sprintf(`<div class="diagram diagram-%s">%s</div>`, lang, svg))
+				return
+			}
+			w.add("failed to render diagram: %v", err)
+		}
+
+		switch lang {
+		case diagramMermaid:
+			s.Parent().ReplaceWithHtml(`<div class="diagram mermaid">` + html.EscapeString(source) + `</div>`)
+			needMermaid = true
+		case diagramPlantUML:
+			if r.PlantUMLServer == "" {
+				w.add("plantuml diagram is left as code since neither command nor server is configured")
+				return
+			}
+			src := strings.TrimRight(r.PlantUMLServer, "/") + "/svg/" + encodePlantUML(source)
+			s.Parent().ReplaceWithHtml(`<div class="diagram diagram-plantuml"><img src="` + html.EscapeString(src) + `" alt="diagram"></div>`)
+		}
+	})
+
+	if needMermaid {
+		return mermaidScript
+	}
+	return ""
+}
+
+// run command with the diagram source as input and get svg it outputs.
+// the command is killed when ctx is done or it does not finish in
+// diagramTimeout.
+func runDiagramCommand(ctx context.Context, command, source string) (string, error) {
+	args, err := splitCommand(command)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, diagramTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(source)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", errors.Errorf("%s: timed out after %v", command, diagramTimeout)
+		}
+		return "", errors.Wrapf(err, "%s: %s", command, strings.TrimSpace(stderr.String()))
+	}
+
+	return svgPrologPattern.ReplaceAllString(stdout.String(), ""), nil
+}
+
+// split command line into arguments as shells do. arguments can be quoted
+// with single or double quotes. backslash escapes quotes only, so that
+// windows paths such as C:\tools\plantuml.bat can be written as they are.
+func splitCommand(command string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	quote := rune(0)
+	escaped := false
+
+	for _, c := range command {
+		switch {
+		case escaped:
+			if c != '\'' && c != '"' {
+				arg.WriteRune('\\')
+			}
+			arg.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inArg = c, true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, errors.Errorf("unterminated quote or escape in command: %s", command)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return args, nil
+}
+
+// encode diagram source as PlantUML server accepts in url
+func encodePlantUML(source string) string {
+	var compressed bytes.Buffer
+	w, _ := flate.NewWriter(&compressed, flate.BestCompression)
+	w.Write([]byte(source))
+	w.Close()
+
+	// PlantUML encodes every 3 bytes, filling the last group with zeros
+	data := compressed.Bytes()
+	if rest := len(data) % 3; rest != 0 {
+		data = append(data, make([]byte, 3-rest)...)
+	}
+
+	return plantUMLEncoding.EncodeToString(data)
+}
+
+// get language of code element from its class, e.g. "go" of "language-go"
+func codeLanguage(s *goquery.Selection) string {
+	class, _ := s.Attr("class")
+	for _, c := range strings.Fields(class) {
+		if strings.HasPrefix(c, "language-") {
+			return strings.ToLower(strings.TrimPrefix(c, "language-"))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+package renderer
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestEncodePlantUML(t *testing.T) {
+	source := "Bob -> Alice : hello"
+	encoded := encodePlantUML(source)
+
+	if len(encoded)%4 != 0 {
+		t.Errorf("encoded length should be multiple of 4: %v", encoded)
+	}
+
+	data, err := plantUMLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	decoded, _ := ioutil.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	if string(decoded) != source {
+		t.Errorf("\ngot %v\nwant %v", string(decoded), source)
+	}
+}
+
+func TestRenderDiagramsInBrowser(t *testing.T) {
+	src := `<pre><code class="language-mermaid">graph TD; A--&gt;B;</code></pre>` +
+		`<pre><code class="language-plantuml">Bob -&gt; Alice</code></pre>` +
+		`<pre><code class="language-go">package main</code></pre>`
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(src))
+
+	r := Renderer{PlantUMLServer: "http://localhost:8080/"}
+	scripts := r.renderDiagrams(context.Background(), doc, &warnings{})
+
+	if got := doc.Find("div.mermaid").Text(); got != "graph TD; A-->B;" {
+		t.Errorf("\ngot %v\nwant %v", got, "graph TD; A-->B;")
+	}
+	if !strings.Contains(scripts, "mermaid.initialize") {
+		t.Errorf("mermaid script is not included: %v", scripts)
+	}
+
+	img, _ := doc.Find("div.diagram-plantuml img").Attr("src")
+	if want := "http://localhost:8080/svg/" + encodePlantUML("Bob -> Alice"); img != want {
+		t.Errorf("\ngot %v\nwant %v", img, want)
+	}
+
+	if doc.Find("code.language-go").Length() != 1 {
+		t.Error("code block other than diagram was modified")
+	}
+}
+
+func TestRenderDiagramsNoScript(t *testing.T) {
+	src := `<pre><code class="language-plantuml">Bob -&gt; Alice</code></pre>`
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(src))
+
+	r := Renderer{}
+	if scripts := r.renderDiagrams(context.Background(), doc, &warnings{}); scripts != "" {
+		t.Errorf("script is included though no mermaid diagram exists: %v", scripts)
+	}
+}
+
+func TestRenderDiagramsNoPlantUMLServer(t *testing.T) {
+	src := `<pre><code class="language-plantuml">Bob -&gt; Alice</code></pre>`
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(src))
+
+	r := Renderer{}
+	w := warnings{}
+	r.renderDiagrams(context.Background(), doc, &w)
+
+	// the diagram is sent to no server
+	if doc.Find("img").Length() != 0 || doc.Find("code.language-plantuml").Length() != 1 {
+		t.Errorf("diagram is not left as code: %v", doc.Text())
+	}
+	if len(w) != 1 {
+		t.Errorf("\ngot %v\nwant %v", len(w), 1)
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	type TestCase struct {
+		command string
+		args    []string
+	}
+
+	cases := []TestCase{
+		TestCase{command: "plantuml -tsvg -pipe", args: []string{"plantuml", "-tsvg", "-pipe"}},
+		TestCase{command: `"C:\Program Files\mmdc.cmd"  -i -`, args: []string{`C:\Program Files\mmdc.cmd`, "-i", "-"}},
+		TestCase{command: `java -jar '/opt/plant uml/plantuml.jar' ""`, args: []string{"java", "-jar", "/opt/plant uml/plantuml.jar", ""}},
+		TestCase{command: `echo \"a b\"`, args: []string{"echo", `"a`, `b"`}},
+	}
+
+	for _, c := range cases {
+		args, err := splitCommand(c.command)
+		if err != nil {
+			t.Errorf("%s unexpectedly gave an error: %v", c.command, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, c.args) {
+			t.Errorf("\n%s\ngot %q\nwant %q", c.command, args, c.args)
+		}
+	}
+
+	for _, command := range []string{"", "  ", `plantuml "-tsvg`} {
+		if _, err := splitCommand(command); err == nil {
+			t.Errorf("%q gave no error", command)
+		}
+	}
+}
+
+func TestRenderDiagramsCommandFailure(t *testing.T) {
+	src := `<pre><code class="language-mermaid">graph TD; A--&gt;B;</code></pre>`
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(src))
+
+	r := Renderer{DiagramCommands: map[string]string{diagramMermaid: "command_not_exists"}}
+	w := warnings{}
+	r.renderDiagrams(context.Background(), doc, &w)
+
+	// the diagram falls back to browser rendering with a warning
+	if doc.Find("div.mermaid").Length() != 1 {
+		t.Error("diagram did not fall back to browser rendering")
+	}
+	if len(w) != 1 || !strings.Contains(w[0], "command_not_exists") {
+		t.Errorf("unexpected warnings: %v", w)
+	}
+}
@@ -0,0 +1,80 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/russross/blackfriday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+// names of markdown engines
+const (
+	// blackfriday with its common extensions, which is the default
+	EngineBlackfriday = "blackfriday"
+	// goldmark, compliant with CommonMark specification
+	EngineCommonMark = "commonmark"
+	// goldmark with GitHub Flavored Markdown extensions and footnotes
+	EngineGFM = "gfm"
+)
+
+// MarkdownEngine converts markdown into html.
+type MarkdownEngine interface {
+	Convert(source []byte) ([]byte, error)
+}
+
+// NewEngine creates the markdown engine of the name.
+func NewEngine(name string) (MarkdownEngine, error) {
+	switch name {
+	case "", EngineBlackfriday:
+		return blackfridayEngine{}, nil
+	case EngineCommonMark:
+		return &goldmarkEngine{
+			name: name,
+			md: goldmark.New(
+				// raw html is kept as blackfriday does
+				goldmark.WithRendererOptions(html.WithUnsafe()),
+			),
+		}, nil
+	case EngineGFM:
+		return &goldmarkEngine{
+			name: name,
+			md: goldmark.New(
+				goldmark.WithExtensions(
+					// alignment is written as align attribute as GitHub does
+					extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+					extension.Strikethrough,
+					extension.Linkify,
+					extension.TaskList,
+					extension.Footnote,
+				),
+				goldmark.WithRendererOptions(html.WithUnsafe()),
+			),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown markdown engine: %s", name)
+	}
+}
+
+// engine using blackfriday
+type blackfridayEngine struct{}
+
+func (blackfridayEngine) Convert(source []byte) ([]byte, error) {
+	return blackfriday.MarkdownCommon(source), nil
+}
+
+// engine using goldmark
+type goldmarkEngine struct {
+	name string
+	md   goldmark.Markdown
+}
+
+func (e *goldmarkEngine) Convert(source []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := e.md.Convert(source, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,104 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewEngine(t *testing.T) {
+	for _, name := range []string{"", EngineBlackfriday, EngineCommonMark} {
+		engine, err := NewEngine(name)
+		if err != nil {
+			t.Errorf("NewEngine unexpectedly gave an error for %q: %v", name, err)
+			continue
+		}
+
+		html, err := engine.Convert([]byte("# Title\n\nsome *text*\n"))
+		if err != nil {
+			t.Errorf("Convert unexpectedly gave an error for %q: %v", name, err)
+		}
+		if !strings.Contains(string(html), "<em>text</em>") {
+			t.Errorf("unexpected html by %q: %s", name, html)
+		}
+	}
+
+	if _, err := NewEngine("unknown"); err == nil {
+		t.Error("NewEngine gave no error for unknown engine")
+	}
+}
+
+func TestCommonMarkEngine(t *testing.T) {
+	engine, _ := NewEngine(EngineCommonMark)
+
+	// a list can interrupt a paragraph in CommonMark
+	html, err := engine.Convert([]byte("paragraph\n- item\n"))
+	if err != nil {
+		t.Fatalf("Convert unexpectedly gave an error: %v", err)
+	}
+
+	want := "<p>paragraph</p>\n<ul>\n<li>item</li>\n</ul>\n"
+	if string(html) != want {
+		t.Errorf("\ngot %q\nwant %q", string(html), want)
+	}
+}
+
+func TestGFMEngine(t *testing.T) {
+	type TestCase struct {
+		markdown string
+		expected string
+	}
+
+	// expected outputs are taken from examples of GitHub Flavored Markdown
+	// specification, except footnotes which the specification does not cover.
+	testCases := []TestCase{
+		// task list items
+		TestCase{
+			"- [ ] foo\n- [x] bar\n",
+			"<ul>\n<li><input disabled=\"\" type=\"checkbox\"> foo</li>\n<li><input checked=\"\" disabled=\"\" type=\"checkbox\"> bar</li>\n</ul>\n",
+		},
+		// strikethrough
+		TestCase{
+			"~~Hi~~ Hello, world!\n",
+			"<p><del>Hi</del> Hello, world!</p>\n",
+		},
+		// autolinks
+		TestCase{
+			"Visit www.commonmark.org/help for more information.\n",
+			"<p>Visit <a href=\"http://www.commonmark.org/help\">www.commonmark.org/help</a> for more information.</p>\n",
+		},
+		TestCase{
+			"https://example.com\n",
+			"<p><a href=\"https://example.com\">https://example.com</a></p>\n",
+		},
+		// table alignment
+		TestCase{
+			"| abc | defghi |\n:-: | -----------:\nbar | baz\n",
+			"<table>\n<thead>\n<tr>\n<th align=\"center\">abc</th>\n<th align=\"right\">defghi</th>\n</tr>\n</thead>\n" +
+				"<tbody>\n<tr>\n<td align=\"center\">bar</td>\n<td align=\"right\">baz</td>\n</tr>\n</tbody>\n</table>\n",
+		},
+		// footnotes with back references
+		TestCase{
+			"Text[^1].\n\n[^1]: Note.\n",
+			"<p>Text<sup id=\"fnref:1\"><a href=\"#fn:1\" class=\"footnote-ref\" role=\"doc-noteref\">1</a></sup>.</p>\n" +
+				"<div class=\"footnotes\" role=\"doc-endnotes\">\n<hr>\n<ol>\n<li id=\"fn:1\">\n" +
+				"<p>Note.&#160;<a href=\"#fnref:1\" class=\"footnote-backref\" role=\"doc-backlink\">&#x21a9;&#xfe0e;</a></p>\n" +
+				"</li>\n</ol>\n</div>\n",
+		},
+	}
+
+	engine, err := NewEngine(EngineGFM)
+	if err != nil {
+		t.Fatalf("NewEngine unexpectedly gave an error: %v", err)
+	}
+
+	for i, testCase := range testCases {
+		html, err := engine.Convert([]byte(testCase.markdown))
+		if err != nil {
+			t.Errorf("\n%d Convert unexpectedly gave an error: %v", i, err)
+			continue
+		}
+		if string(html) != testCase.expected {
+			t.Errorf("\n%d\ngot %q\nwant %q", i, string(html), testCase.expected)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package renderer
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultExtensions are extensions of markdown files used when Renderer has
+// no Extensions.
+var DefaultExtensions = []string{".md", ".markdown", ".mdown", ".mkd"}
+
+// IsMarkdown reports whether the file has one of the extensions, ignoring
+// case. extensions may be written with or without the leading dot.
+// DefaultExtensions are used if extensions is empty.
+func IsMarkdown(path string, extensions []string) bool {
+	if len(extensions) == 0 {
+		extensions = DefaultExtensions
+	}
+
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	if ext == "" {
+		return false
+	}
+	for _, e := range extensions {
+		if strings.EqualFold(ext, strings.TrimPrefix(e, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// see if the file has an extension of markdown files rendered
+func (r *Renderer) isMarkdown(path string) bool {
+	return IsMarkdown(path, r.Extensions)
+}
+
+// get the index document written by the user in the directory, such as
+// index.md or INDEX.md, or empty if the directory has none
+func (r *Renderer) indexDocument(dir string) string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	for _, info := range infos {
+		name := info.Name()
+		if !info.IsDir() && strings.EqualFold(dropExtension(name), "index") && r.isMarkdown(name) {
+			return filepath.Join(dir, name)
+		}
+	}
+	return ""
+}
+
+// get the markdown file whose html is the index page of the directory,
+// which is index.md generated in site mode if the user has not written one
+func (r *Renderer) indexPage(dir string) string {
+	if index := r.indexDocument(dir); index != "" {
+		return index
+	}
+	return filepath.Join(dir, "index.md")
+}
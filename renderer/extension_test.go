@@ -0,0 +1,67 @@
+package renderer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsMarkdown(t *testing.T) {
+	type TestCase struct {
+		path       string
+		extensions []string
+		expected   bool
+	}
+
+	testCases := []TestCase{
+		TestCase{"docs/a.md", nil, true},
+		TestCase{"README.MD", nil, true},
+		TestCase{"notes.Markdown", nil, true},
+		TestCase{"notes.mdown", nil, true},
+		TestCase{"notes.mkd", nil, true},
+		TestCase{"notes.txt", nil, false},
+		TestCase{"md", nil, false},
+		TestCase{"notes.txt", []string{"txt"}, true},
+		TestCase{"notes.TXT", []string{".txt"}, true},
+		TestCase{"notes.md", []string{".txt"}, false},
+	}
+
+	for _, testCase := range testCases {
+		actual := IsMarkdown(testCase.path, testCase.extensions)
+		if actual != testCase.expected {
+			t.Errorf("\n%v %v\ngot %v\nwant %v", testCase.path, testCase.extensions, actual, testCase.expected)
+		}
+	}
+}
+
+func TestIndexDocument(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	r := Renderer{}
+	if index := r.indexDocument(baseDir); index != "" {
+		t.Errorf("\ngot %v\nwant %v", index, "")
+	}
+
+	ioutil.WriteFile(filepath.Join(baseDir, "index.txt"), []byte("text"), 0644)
+	ioutil.WriteFile(filepath.Join(baseDir, "index.Markdown"), []byte("# Index"), 0644)
+
+	expected := filepath.Join(baseDir, "index.Markdown")
+	if index := r.indexDocument(baseDir); index != expected {
+		t.Errorf("\ngot %v\nwant %v", index, expected)
+	}
+
+	// the name is case insensitive as well
+	sub := filepath.Join(baseDir, "sub")
+	os.MkdirAll(sub, 0755)
+	ioutil.WriteFile(filepath.Join(sub, "INDEX.md"), []byte("# Index"), 0644)
+
+	expected = filepath.Join(sub, "INDEX.md")
+	if index := r.indexDocument(sub); index != expected {
+		t.Errorf("\ngot %v\nwant %v", index, expected)
+	}
+}
@@ -0,0 +1,104 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// FrontMatter is metadata written at the beginning of a markdown file.
+type FrontMatter map[string]interface{}
+
+// split front matter from markdown contents.
+//
+// front matter is a YAML block surrounded by "---" lines or a TOML block
+// surrounded by "+++" lines, placed at the very beginning of the file.
+// if the file does not start with front matter, or the block is not closed,
+// nil is returned with the whole data as body.
+func parseFrontMatter(data []byte) (FrontMatter, []byte, error) {
+	// editors on windows may put byte order mark.
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	first, rest := splitLine(data)
+	delimiter := strings.TrimSpace(string(first))
+	if delimiter != "---" && delimiter != "+++" {
+		return nil, data, nil
+	}
+
+	var block []byte
+	body := rest
+	closed := false
+	for len(body) > 0 {
+		line, next := splitLine(body)
+		trimmed := strings.TrimSpace(string(line))
+		if trimmed == delimiter || (delimiter == "---" && trimmed == "...") {
+			body = next
+			closed = true
+			break
+		}
+		block = append(block, line...)
+		block = append(block, '\n')
+		body = next
+	}
+
+	if !closed {
+		// probably a horizontal rule rather than front matter
+		return nil, data, nil
+	}
+
+	meta := FrontMatter{}
+	if delimiter == "---" {
+		if err := yaml.Unmarshal(block, &meta); err != nil {
+			return nil, nil, errors.Wrap(err, "invalid YAML front matter")
+		}
+	} else {
+		if _, err := toml.Decode(string(block), &meta); err != nil {
+			return nil, nil, errors.Wrap(err, "invalid TOML front matter")
+		}
+	}
+
+	return meta, body, nil
+}
+
+// String returns the value of key formatted to be embedded in html.
+// it returns empty string if the key does not exist.
+func (f FrontMatter) String(key string) string {
+	return formatValue(f[key])
+}
+
+// format front matter value as plain text
+func formatValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case time.Time:
+		if value.Hour() == 0 && value.Minute() == 0 && value.Second() == 0 {
+			return value.Format("2006-01-02")
+		}
+		return value.Format(time.RFC3339)
+	case []interface{}:
+		var items []string
+		for _, item := range value {
+			items = append(items, formatValue(item))
+		}
+		return strings.Join(items, ", ")
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// split the first line from data. line does not include line break.
+func splitLine(data []byte) (line, rest []byte) {
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return data, nil
+	}
+	return bytes.TrimSuffix(data[:i], []byte("\r")), data[i+1:]
+}
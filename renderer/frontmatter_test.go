@@ -0,0 +1,74 @@
+package renderer
+
+import (
+	"testing"
+)
+
+func TestParseFrontMatterYAML(t *testing.T) {
+	data := "---\r\ntitle: Design Doc\r\ntags: [go, markdown]\r\ndate: 2017-06-01\r\n---\r\n# Heading\r\n"
+
+	meta, body, err := parseFrontMatter([]byte(data))
+	if err != nil {
+		t.Fatalf("parseFrontMatter unexpectedly gave an error: %v", err)
+	}
+
+	if got := meta.String("title"); got != "Design Doc" {
+		t.Errorf("\ngot %v\nwant %v", got, "Design Doc")
+	}
+	if got := meta.String("tags"); got != "go, markdown" {
+		t.Errorf("\ngot %v\nwant %v", got, "go, markdown")
+	}
+	if got := meta.String("date"); got != "2017-06-01" {
+		t.Errorf("\ngot %v\nwant %v", got, "2017-06-01")
+	}
+	if got := string(body); got != "# Heading\r\n" {
+		t.Errorf("\ngot %q\nwant %q", got, "# Heading\r\n")
+	}
+}
+
+func TestParseFrontMatterTOML(t *testing.T) {
+	data := "+++\ntitle = \"Design Doc\"\nauthor = \"taq-f\"\ndate = 2017-06-01T10:30:00Z\n+++\n# Heading\n"
+
+	meta, body, err := parseFrontMatter([]byte(data))
+	if err != nil {
+		t.Fatalf("parseFrontMatter unexpectedly gave an error: %v", err)
+	}
+
+	if got := meta.String("author"); got != "taq-f" {
+		t.Errorf("\ngot %v\nwant %v", got, "taq-f")
+	}
+	if got := meta.String("date"); got != "2017-06-01T10:30:00Z" {
+		t.Errorf("\ngot %v\nwant %v", got, "2017-06-01T10:30:00Z")
+	}
+	if got := string(body); got != "# Heading\n" {
+		t.Errorf("\ngot %q\nwant %q", got, "# Heading\n")
+	}
+}
+
+func TestParseFrontMatterNone(t *testing.T) {
+	testCases := []string{
+		"# Heading\n",
+		"---\nnot closed, so this is just a horizontal rule\n",
+		"",
+	}
+
+	for i, testCase := range testCases {
+		meta, body, err := parseFrontMatter([]byte(testCase))
+		if err != nil {
+			t.Errorf("\n%d parseFrontMatter unexpectedly gave an error: %v", i, err)
+		}
+		if meta != nil {
+			t.Errorf("\n%d front matter unexpectedly detected: %v", i, meta)
+		}
+		if string(body) != testCase {
+			t.Errorf("\n%d\ngot %q\nwant %q", i, string(body), testCase)
+		}
+	}
+}
+
+func TestParseFrontMatterInvalid(t *testing.T) {
+	_, _, err := parseFrontMatter([]byte("---\ntitle: [unclosed\n---\n"))
+	if err == nil {
+		t.Error("parseFrontMatter gave no error even though front matter is broken")
+	}
+}
@@ -0,0 +1,96 @@
+package renderer
+
+import (
+	"bytes"
+	"html"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/alecthomas/chroma"
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+)
+
+// DefaultTheme is the color theme of syntax highlighting used if not specified.
+const DefaultTheme = "github"
+
+// HasTheme reports whether the color theme of syntax highlighting exists.
+func HasTheme(name string) bool {
+	_, ok := styles.Registry[name]
+	return ok
+}
+
+// highlight inside of code tag with the lexer of its language. line numbers,
+// highlighted lines and title are added as options of the code block say.
+func (r *Renderer) highlightCode(doc *goquery.Document, w *warnings) {
+	doc.Find("code[class*=\"language-\"], pre > code[data-options]").Each(func(i int, s *goquery.Selection) {
+		oldCode := s.Text()
+
+		attr, _ := s.Attr("data-options")
+		s.RemoveAttr("data-options")
+		options := parseCodeOptions(attr)
+
+		formatter := chromahtml.New(
+			chromahtml.WithClasses(true),
+			chromahtml.PreventSurroundingPre(true),
+			chromahtml.WithLineNumbers(options.lineNumbers),
+			chromahtml.BaseLineNumber(options.lineNumberStart),
+			chromahtml.HighlightLines(options.highlightLines),
+		)
+
+		lexer := lexers.Get(codeLanguage(s))
+		if lexer == nil {
+			lexer = lexers.Analyse(oldCode)
+		}
+		if lexer == nil {
+			lexer = lexers.Fallback
+		}
+
+		iterator, err := chroma.Coalesce(lexer).Tokenise(nil, oldCode)
+		if err != nil {
+			w.add("failed to syntax highlight: %v", err)
+			return
+		}
+
+		var formatted bytes.Buffer
+		if err := formatter.Format(&formatted, r.theme(), iterator); err != nil {
+			w.add("failed to syntax highlight: %v", err)
+			return
+		}
+
+		s.SetHtml(formatted.String())
+		if !s.Parent().Is("pre") {
+			return
+		}
+		// theme colors are applied under chroma class
+		pre := s.Parent().AddClass("chroma")
+
+		if options.title != "" {
+			pre.WrapHtml(`<div class="code-block"></div>`)
+			pre.BeforeHtml(`<div class="code-title">` + html.EscapeString(options.title) + `</div>`)
+		}
+	})
+}
+
+// get style of syntax highlighting
+func (r *Renderer) theme() *chroma.Style {
+	if r.Theme == "" {
+		return styles.Get(DefaultTheme)
+	}
+	return styles.Get(r.Theme)
+}
+
+// style tag of the syntax highlighting theme
+func (r *Renderer) highlightStyle() string {
+	r.themeOnce.Do(func() {
+		var css bytes.Buffer
+		formatter := chromahtml.New(chromahtml.WithClasses(true))
+		if err := formatter.WriteCSS(&css, r.theme()); err != nil {
+			r.logger().Warn("failed to create style of syntax highlighting", "theme", r.Theme, "error", err)
+			return
+		}
+		r.themeStyle = "\n<style>\n" + css.String() + "</style>\n"
+	})
+
+	return r.themeStyle
+}
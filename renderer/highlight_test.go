@@ -0,0 +1,47 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestHighlightCode(t *testing.T) {
+	src := `<pre><code class="language-go">func main() {}</code></pre>` +
+		`<pre><code class="language-python">def main(): pass</code></pre>`
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(src))
+
+	r := Renderer{}
+	r.highlightCode(doc, &warnings{})
+
+	if doc.Find("pre.chroma").Length() != 2 {
+		t.Error("chroma class is not added to pre")
+	}
+
+	// keywords of each language are highlighted
+	keywords := doc.Find("span.kd, span.k").Map(func(i int, s *goquery.Selection) string {
+		return s.Text()
+	})
+	if strings.Join(keywords, ",") != "func,def,pass" {
+		t.Errorf("\ngot %v\nwant %v", keywords, "func,def,pass")
+	}
+}
+
+func TestHighlightStyle(t *testing.T) {
+	r := Renderer{Theme: "monokai"}
+	style := r.highlightStyle()
+
+	if !strings.HasPrefix(strings.TrimSpace(style), "<style>") || !strings.Contains(style, ".chroma") {
+		t.Errorf("unexpected style of syntax highlighting: %v", style)
+	}
+}
+
+func TestHasTheme(t *testing.T) {
+	if !HasTheme(DefaultTheme) {
+		t.Errorf("default theme does not exist: %v", DefaultTheme)
+	}
+	if HasTheme("theme_not_exists") {
+		t.Error("HasTheme returned true for unknown theme")
+	}
+}
@@ -0,0 +1,337 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// directive including another file, e.g. {{< include "common/footer.md" >}}
+	// or {{< code "src/main.go" lines="10-30" >}}
+	includePattern = regexp.MustCompile(`\{\{<\s*(include|code)\s+"([^"]+)"((?:\s+[\w-]+=(?:"[^"]*"|[^\s">]+))*)\s*>\}\}`)
+	// an attribute of include directive, e.g. lines="10-30"
+	includeAttrPattern = regexp.MustCompile(`([\w-]+)=(?:"([^"]*)"|([^\s">]+))`)
+	// backticks starting a line, which the fence of included code must be
+	// longer than
+	backticksPattern = regexp.MustCompile("(?m)^\\s*(`{3,})")
+)
+
+// replace include directives in markdown of the file with contents of the
+// files they refer to, which are resolved relative to the file including
+// them. directives in fenced code blocks are left as they are.
+//
+// returns files included directly or indirectly, even if it fails.
+// stack is the chain of files including this file, to detect cycles.
+func expandIncludes(path string, data []byte, stack []string) ([]byte, []string, error) {
+	path = filepath.Clean(path)
+	stack = append(stack[:len(stack):len(stack)], path)
+
+	var out bytes.Buffer
+	var included []string
+
+	fence := ""
+	for len(data) > 0 {
+		line, rest := splitLine(data)
+		raw := data[:len(data)-len(rest)]
+		data = rest
+
+		trimmed := strings.TrimSpace(string(line))
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			out.Write(raw)
+			continue
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+			out.Write(raw)
+			continue
+		}
+
+		var err error
+		expanded := includePattern.ReplaceAllFunc(raw, func(directive []byte) []byte {
+			if err != nil {
+				return directive
+			}
+			m := includePattern.FindSubmatch(directive)
+			target := filepath.Join(filepath.Dir(path), filepath.FromSlash(string(m[2])))
+			attrs := parseIncludeAttrs(string(m[3]))
+
+			var content []byte
+			var nested []string
+			if string(m[1]) == "code" {
+				content, err = includeCode(target, attrs)
+				nested = []string{target}
+			} else {
+				content, nested, err = includeMarkdown(target, stack)
+			}
+			included = append(included, nested...)
+			return content
+		})
+		if err != nil {
+			return nil, included, errors.Wrapf(err, "failed to include into %s", path)
+		}
+		out.Write(expanded)
+	}
+
+	return out.Bytes(), included, nil
+}
+
+// get markdown of the file, in which include directives are expanded.
+// relative links and images in it are rewritten to be relative to the file
+// including it, the last one in stack.
+func includeMarkdown(path string, stack []string) ([]byte, []string, error) {
+	for i, p := range stack {
+		if p == path {
+			chain := append(append([]string{}, stack[i:]...), path)
+			return nil, nil, fmt.Errorf("include cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, []string{path}, err
+	}
+	// front matter of included files is not a part of the document
+	_, body, err := parseFrontMatter(data)
+	if err != nil {
+		return nil, []string{path}, errors.Wrapf(err, "failed to parse front matter of %s", path)
+	}
+
+	expanded, included, err := expandIncludes(path, body, stack)
+	if len(stack) > 0 {
+		expanded = rebaseLinks(expanded, filepath.Dir(path), filepath.Dir(stack[len(stack)-1]))
+	}
+	return bytes.TrimRight(expanded, "\r\n"), append([]string{path}, included...), err
+}
+
+// rewrite relative links and images in markdown, which are relative to from
+// directory, to be relative to to directory. code blocks and code spans are
+// left as they are.
+func rebaseLinks(data []byte, from, to string) []byte {
+	if from == to {
+		return data
+	}
+
+	var out bytes.Buffer
+	fence := ""
+	for len(data) > 0 {
+		line, rest := splitLine(data)
+		raw := data[:len(data)-len(rest)]
+		data = rest
+
+		trimmed := strings.TrimSpace(string(line))
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+		case bytes.HasPrefix(line, []byte("    ")) || bytes.HasPrefix(line, []byte("\t")):
+			// indented code block
+		default:
+			out.WriteString(rebaseLine(string(raw), from, to))
+			continue
+		}
+		out.Write(raw)
+	}
+
+	return out.Bytes()
+}
+
+// rewrite relative urls of links and images in a line of markdown
+func rebaseLine(line, from, to string) string {
+	s := codeSpanPattern.ReplaceAllStringFunc(line, func(code string) string {
+		return strings.Repeat(" ", len(code))
+	})
+
+	// positions of urls in the line
+	var urls [][]int
+	for _, m := range inlineLinkPattern.FindAllStringSubmatchIndex(s, -1) {
+		urls = append(urls, m[2:4])
+	}
+	if m := referenceDefinitionPattern.FindStringSubmatchIndex(s); m != nil {
+		urls = append(urls, m[2:4])
+	}
+	for _, m := range htmlLinkPattern.FindAllStringSubmatchIndex(s, -1) {
+		urls = append(urls, m[4:6])
+	}
+	sort.Slice(urls, func(i, j int) bool { return urls[i][0] < urls[j][0] })
+
+	var b strings.Builder
+	prev := 0
+	for _, u := range urls {
+		if u[0] < prev {
+			continue
+		}
+		b.WriteString(line[prev:u[0]])
+		b.WriteString(rebaseURL(line[u[0]:u[1]], from, to))
+		prev = u[1]
+	}
+	b.WriteString(line[prev:])
+	return b.String()
+}
+
+// rewrite the url relative to from directory to be relative to to directory.
+// urls other than relative ones are returned as they are.
+func rebaseURL(href, from, to string) string {
+	linkPath, suffix := splitURL(href)
+	if !isRelativeLink(linkPath) {
+		return href
+	}
+	unescaped, err := url.PathUnescape(linkPath)
+	if err != nil {
+		return href
+	}
+
+	rebased := relativeURL(to, filepath.Join(from, filepath.FromSlash(unescaped)))
+	if unescaped != linkPath {
+		// keep the link escaped as written
+		rebased = (&url.URL{Path: rebased}).EscapedPath()
+	}
+	return rebased + suffix
+}
+
+// get lines of the file as a fenced code block. the language is taken from
+// the file extension unless lang attribute is given. other attributes than
+// lines and lang are passed to the code block as its options.
+func includeCode(path string, attrs map[string]string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	code := strings.TrimRight(strings.Replace(string(data), "\r\n", "\n", -1), "\n")
+	if lines, ok := attrs["lines"]; ok {
+		if code, err = selectLines(code, lines); err != nil {
+			return nil, errors.Wrapf(err, "failed to include %s", path)
+		}
+	}
+
+	lang, ok := attrs["lang"]
+	if !ok {
+		lang = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+
+	var options []string
+	for key, value := range attrs {
+		if key != "lines" && key != "lang" {
+			options = append(options, fmt.Sprintf("%s=%q", key, value))
+		}
+	}
+	sort.Strings(options)
+
+	info := lang
+	if len(options) > 0 {
+		info += " {" + strings.Join(options, " ") + "}"
+	}
+
+	fence := "```"
+	for _, m := range backticksPattern.FindAllStringSubmatch(code, -1) {
+		if len(m[1]) >= len(fence) {
+			fence = m[1] + "`"
+		}
+	}
+
+	return []byte(fence + info + "\n" + code + "\n" + fence), nil
+}
+
+// select lines of the range such as "10-30", "10-" or "10", which are 1-based.
+func selectLines(code, lines string) (string, error) {
+	all := strings.Split(code, "\n")
+
+	bounds := strings.SplitN(lines, "-", 2)
+	from, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return "", fmt.Errorf("invalid lines: %s", lines)
+	}
+	to := from
+	if len(bounds) == 2 {
+		if strings.TrimSpace(bounds[1]) == "" {
+			to = len(all)
+		} else if to, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil {
+			return "", fmt.Errorf("invalid lines: %s", lines)
+		}
+	}
+
+	if from < 1 || to < from || from > len(all) {
+		return "", fmt.Errorf("lines out of range: %s", lines)
+	}
+	if to > len(all) {
+		to = len(all)
+	}
+
+	return strings.Join(all[from-1:to], "\n"), nil
+}
+
+// parse attributes of include directive
+func parseIncludeAttrs(text string) map[string]string {
+	attrs := map[string]string{}
+	for _, m := range includeAttrPattern.FindAllStringSubmatch(text, -1) {
+		attrs[m[1]] = m[2] + m[3]
+	}
+	return attrs
+}
+
+// record files the document includes
+func (r *Renderer) setIncludes(path string, included []string) {
+	r.includesMu.Lock()
+	defer r.includesMu.Unlock()
+
+	if r.includes == nil {
+		r.includes = map[string][]string{}
+	}
+	r.includes[filepath.Clean(path)] = included
+}
+
+// Dependents returns documents including the file directly or indirectly,
+// or referencing it as an image, which need to be rendered again when the
+// file changes.
+func (r *Renderer) Dependents(path string) []string {
+	r.includesMu.Lock()
+	defer r.includesMu.Unlock()
+
+	path = filepath.Clean(path)
+
+	var dependents []string
+	for doc, included := range r.includes {
+		for _, p := range included {
+			if p == path {
+				dependents = append(dependents, doc)
+				break
+			}
+		}
+	}
+	sort.Strings(dependents)
+	return dependents
+}
+
+// Includes returns all files included by documents rendered so far.
+func (r *Renderer) Includes() []string {
+	r.includesMu.Lock()
+	defer r.includesMu.Unlock()
+
+	seen := map[string]bool{}
+	var files []string
+	for _, included := range r.includes {
+		for _, p := range included {
+			if !seen[p] {
+				seen[p] = true
+				files = append(files, p)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files
+}
@@ -0,0 +1,169 @@
+package renderer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandIncludes(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	os.MkdirAll(filepath.Join(baseDir, "common"), 0755)
+	os.MkdirAll(filepath.Join(baseDir, "src"), 0755)
+	footer := filepath.Join(baseDir, "common", "footer.md")
+	contact := filepath.Join(baseDir, "common", "contact.md")
+	code := filepath.Join(baseDir, "src", "main.go")
+	ioutil.WriteFile(footer, []byte("---\ntitle: Footer\n---\nfooter\n{{< include \"contact.md\" >}}\n"), 0644)
+	ioutil.WriteFile(contact, []byte("contact\n"), 0644)
+	ioutil.WriteFile(code, []byte("package main\n\nfunc main() {\n}\n"), 0644)
+
+	doc := filepath.Join(baseDir, "doc.md")
+	markdown := "# Doc\n" +
+		"{{< include \"common/footer.md\" >}}\n" +
+		"{{< code \"src/main.go\" lines=\"3-4\" title=\"main.go\" >}}\n" +
+		"```\n{{< include \"common/footer.md\" >}}\n```\n"
+
+	expanded, included, err := expandIncludes(doc, []byte(markdown), nil)
+	if err != nil {
+		t.Fatalf("expandIncludes unexpectedly gave an error: %v", err)
+	}
+
+	expected := "# Doc\n" +
+		"footer\ncontact\n" +
+		"```go {title=\"main.go\"}\nfunc main() {\n}\n```\n" +
+		"```\n{{< include \"common/footer.md\" >}}\n```\n"
+	if string(expanded) != expected {
+		t.Errorf("\ngot %q\nwant %q", string(expanded), expected)
+	}
+
+	expectedIncluded := []string{footer, contact, code}
+	if !reflect.DeepEqual(included, expectedIncluded) {
+		t.Errorf("\ngot %v\nwant %v", included, expectedIncluded)
+	}
+}
+
+func TestExpandIncludesRebaseLinks(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	os.MkdirAll(filepath.Join(baseDir, "common", "nested"), 0755)
+	part := filepath.Join(baseDir, "common", "part.md")
+	nested := filepath.Join(baseDir, "common", "nested", "note.md")
+	ioutil.WriteFile(part, []byte("![logo](logo.png) [top](../index.md#a) [web](https://example.com/a.md) [here](#b)\n"+
+		"`[code](code.md)` <img src=\"my%20icon.png\">\n"+
+		"[ref]: ref.md\n"+
+		"```\n[fenced](fenced.md)\n```\n"+
+		"{{< include \"nested/note.md\" >}}\n"), 0644)
+	ioutil.WriteFile(nested, []byte("[note](note.md)\n"), 0644)
+
+	doc := filepath.Join(baseDir, "doc.md")
+	expanded, _, err := expandIncludes(doc, []byte("{{< include \"common/part.md\" >}}\n"), nil)
+	if err != nil {
+		t.Fatalf("expandIncludes unexpectedly gave an error: %v", err)
+	}
+
+	// links are relative to the included files, and made relative to doc.md
+	expected := "![logo](common/logo.png) [top](index.md#a) [web](https://example.com/a.md) [here](#b)\n" +
+		"`[code](code.md)` <img src=\"common/my%20icon.png\">\n" +
+		"[ref]: common/ref.md\n" +
+		"```\n[fenced](fenced.md)\n```\n" +
+		"[note](common/nested/note.md)\n"
+	if string(expanded) != expected {
+		t.Errorf("\ngot %q\nwant %q", string(expanded), expected)
+	}
+}
+
+func TestExpandIncludesCycle(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	a := filepath.Join(baseDir, "a.md")
+	b := filepath.Join(baseDir, "b.md")
+	ioutil.WriteFile(a, []byte("{{< include \"b.md\" >}}\n"), 0644)
+	ioutil.WriteFile(b, []byte("{{< include \"a.md\" >}}\n"), 0644)
+
+	data, _ := ioutil.ReadFile(a)
+	_, included, err := expandIncludes(a, data, nil)
+	if err == nil || !strings.Contains(err.Error(), "include cycle: "+a+" -> "+b+" -> "+a) {
+		t.Errorf("unexpected error for include cycle: %v", err)
+	}
+	if !reflect.DeepEqual(included, []string{b}) {
+		t.Errorf("\ngot %v\nwant %v", included, []string{b})
+	}
+
+	// missing files are errors as well
+	_, _, err = expandIncludes(a, []byte("{{< code \"none.go\" >}}\n"), nil)
+	if err == nil {
+		t.Error("expandIncludes gave no error for missing file")
+	}
+}
+
+func TestIncludeCode(t *testing.T) {
+	type TestCase struct {
+		code     string
+		attrs    map[string]string
+		expected string
+	}
+
+	testCases := []TestCase{
+		TestCase{"a\nb\nc\n", map[string]string{"lines": "2-"}, "```txt\nb\nc\n```"},
+		TestCase{"a\r\nb\r\n", map[string]string{"lang": "text", "lines": "1"}, "```text\na\n```"},
+		// fence is longer than fences in the code
+		TestCase{"```go\n```\n", map[string]string{"linenos": "true"}, "````txt {linenos=\"true\"}\n```go\n```\n````"},
+	}
+
+	file, err := ioutil.TempFile("", "markdowner*.txt")
+	if err != nil {
+		t.Fatalf("failed to create temporary file: %v", err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	for i, testCase := range testCases {
+		ioutil.WriteFile(file.Name(), []byte(testCase.code), 0644)
+		actual, err := includeCode(file.Name(), testCase.attrs)
+		if err != nil {
+			t.Errorf("\n%d includeCode unexpectedly gave an error: %v", i, err)
+			continue
+		}
+		if string(actual) != testCase.expected {
+			t.Errorf("\n%d\ngot %q\nwant %q", i, string(actual), testCase.expected)
+		}
+	}
+
+	if _, err := includeCode(file.Name(), map[string]string{"lines": "5-6"}); err == nil {
+		t.Error("includeCode gave no error for lines out of range")
+	}
+}
+
+func TestDependents(t *testing.T) {
+	r := Renderer{}
+	r.setIncludes("/docs/a.md", []string{"/docs/common/footer.md", "/src/main.go"})
+	r.setIncludes("/docs/b.md", []string{"/docs/common/footer.md"})
+
+	expected := []string{"/docs/a.md", "/docs/b.md"}
+	if dependents := r.Dependents("/docs/common/../common/footer.md"); !reflect.DeepEqual(dependents, expected) {
+		t.Errorf("\ngot %v\nwant %v", dependents, expected)
+	}
+
+	// includes are replaced when the document is rendered again
+	r.setIncludes("/docs/b.md", nil)
+	expected = []string{"/docs/common/footer.md", "/src/main.go"}
+	if includes := r.Includes(); !reflect.DeepEqual(includes, expected) {
+		t.Errorf("\ngot %v\nwant %v", includes, expected)
+	}
+}
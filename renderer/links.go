@@ -0,0 +1,74 @@
+package renderer
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// rewrite relative links to markdown files into links to the html files
+// rendered from them. anchors and query strings are kept as they are.
+func (r *Renderer) rewriteLinks(doc *goquery.Document, path string) {
+	from := filepath.Dir(outPath(path, r.OutDir, r.BaseDir))
+
+	doc.Find("a[href]").Each(func(i int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+
+		linkPath, suffix := splitURL(href)
+		target, ok := r.localMarkdown(filepath.Dir(path), linkPath)
+		if !ok {
+			return
+		}
+
+		rewritten := relativeURL(from, outPath(target, r.OutDir, r.BaseDir))
+		if unescaped, _ := url.PathUnescape(linkPath); unescaped != linkPath {
+			// keep the link escaped as written
+			rewritten = (&url.URL{Path: rewritten}).EscapedPath()
+		}
+		s.SetAttr("href", rewritten+suffix)
+	})
+}
+
+// get the markdown file the link points to.
+// ok is false if the link is not a relative link to a markdown file under
+// the base directory.
+func (r *Renderer) localMarkdown(dir, linkPath string) (target string, ok bool) {
+	if !isRelativeLink(linkPath) || !r.isMarkdown(linkPath) {
+		return "", false
+	}
+
+	unescaped, err := url.PathUnescape(linkPath)
+	if err != nil {
+		return "", false
+	}
+
+	target = filepath.Join(dir, filepath.FromSlash(unescaped))
+	if _, ok := r.relPath(target); !ok {
+		return "", false
+	}
+
+	return target, true
+}
+
+// split url into path and the rest (query and fragment)
+func splitURL(href string) (path, suffix string) {
+	if i := strings.IndexAny(href, "?#"); i >= 0 {
+		return href[:i], href[i:]
+	}
+	return href, ""
+}
+
+// see if the link points to a file relatively, not to a page on other sites,
+// an absolute path or an anchor in the same document.
+func isRelativeLink(linkPath string) bool {
+	if linkPath == "" || strings.HasPrefix(linkPath, "/") || strings.HasPrefix(linkPath, "\\") {
+		return false
+	}
+	u, err := url.Parse(linkPath)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "" && u.Host == ""
+}
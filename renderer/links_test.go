@@ -0,0 +1,51 @@
+package renderer
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestRewriteLinks(t *testing.T) {
+	type TestCase struct {
+		href     string
+		expected string
+	}
+
+	testCases := []TestCase{
+		TestCase{"other/page.md#setup", "other/page.html#setup"},
+		TestCase{"../top.md?raw=1#a", "../top.html?raw=1#a"},
+		TestCase{"my%20page.md", "my%20page.html"},
+		TestCase{"日本語.md", "日本語.html"},
+		TestCase{"README.MD", "README.html"},
+		TestCase{"notes.markdown#a", "notes.html#a"},
+		TestCase{"notes.txt", "notes.txt"},
+		TestCase{"image.png", "image.png"},
+		TestCase{"#section", "#section"},
+		TestCase{"https://example.com/readme.md", "https://example.com/readme.md"},
+		TestCase{"/abs/page.md", "/abs/page.md"},
+		TestCase{"../../outside.md", "../../outside.md"},
+		TestCase{"../..notes.md", "../..notes.html"},
+		TestCase{"..notes.md", "..notes.html"},
+	}
+
+	base := filepath.Join(string(filepath.Separator)+"docs", "src")
+	r := Renderer{
+		BaseDir: base,
+		OutDir:  filepath.Join(string(filepath.Separator)+"docs", "out"),
+	}
+
+	for i, testCase := range testCases {
+		src := `<a href="` + testCase.href + `">link</a>`
+		doc, _ := goquery.NewDocumentFromReader(strings.NewReader(src))
+
+		r.rewriteLinks(doc, filepath.Join(base, "guide", "index.md"))
+
+		got, _ := doc.Find("a").Attr("href")
+		if got != testCase.expected {
+			t.Errorf("\n%d\ngot %v\nwant %v", i, got, testCase.expected)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package renderer
+
+import (
+	"log"
+)
+
+// Logger receives messages from Renderer. fields are pairs of a key and a
+// value giving details of the message, such as "path" of the file.
+type Logger interface {
+	Debug(msg string, fields ...interface{})
+	Info(msg string, fields ...interface{})
+	Warn(msg string, fields ...interface{})
+	Error(msg string, fields ...interface{})
+}
+
+// logger used when Renderer has no Logger, which writes to the standard
+// logger as the renderer used to do.
+type stdLogger struct{}
+
+func (stdLogger) Debug(msg string, fields ...interface{}) {}
+
+func (stdLogger) Info(msg string, fields ...interface{}) {
+	log.Println(append([]interface{}{"INFO :", msg}, fields...)...)
+}
+
+func (stdLogger) Warn(msg string, fields ...interface{}) {
+	log.Println(append([]interface{}{"WARN :", msg}, fields...)...)
+}
+
+func (stdLogger) Error(msg string, fields ...interface{}) {
+	log.Println(append([]interface{}{"ERROR:", msg}, fields...)...)
+}
+
+// get the logger messages are written to
+func (r *Renderer) logger() Logger {
+	if r.Logger == nil {
+		return stdLogger{}
+	}
+	return r.Logger
+}
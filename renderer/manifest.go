@@ -0,0 +1,260 @@
+package renderer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ManifestName is the name of the build manifest in the output directory.
+const ManifestName = ".markdowner-manifest.json"
+
+// version of manifest format. manifests of other versions are discarded.
+const manifestVersion = 1
+
+// Manifest records inputs of each rendered file, so that files whose inputs
+// are unchanged can be skipped.
+type Manifest struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]manifestEntry
+}
+
+// inputs and output of a rendered markdown file
+type manifestEntry struct {
+	// hash of the markdown file
+	Source string `json:"source"`
+	// hash of template, style and options of the renderer
+	Config string `json:"config"`
+	// hash of documents linked in navigation
+	Navigation string `json:"navigation"`
+	// hash of each file included and image referenced
+	Includes map[string]string `json:"includes,omitempty"`
+	// path of the html file
+	Output string `json:"output"`
+}
+
+// manifest as written in the file
+type manifestFile struct {
+	Version int                      `json:"version"`
+	Files   map[string]manifestEntry `json:"files"`
+}
+
+// LoadManifest reads the build manifest in the output directory.
+// an empty manifest is returned if it does not exist yet.
+func LoadManifest(outDir string) (*Manifest, error) {
+	m := &Manifest{
+		path:    filepath.Join(outDir, ManifestName),
+		entries: map[string]manifestEntry{},
+	}
+
+	data, err := ioutil.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return m, errors.Wrapf(err, "failed to read %s", m.path)
+	}
+
+	var file manifestFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return m, errors.Wrapf(err, "failed to parse %s", m.path)
+	}
+	if file.Version == manifestVersion && file.Files != nil {
+		m.entries = file.Files
+	}
+	return m, nil
+}
+
+// Save writes the manifest into the output directory.
+func (m *Manifest) Save() error {
+	m.mu.Lock()
+	data, err := json.MarshalIndent(manifestFile{manifestVersion, m.entries}, "", "  ")
+	m.mu.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "failed to encode manifest")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.path), os.ModeDir); err != nil {
+		return errors.Wrapf(err, "failed to create %s", filepath.Dir(m.path))
+	}
+	// the manifest is read by the next build, so it must be readable
+	if err := ioutil.WriteFile(m.path, data, 0644); err != nil {
+		return errors.Wrapf(err, "failed to write %s", m.path)
+	}
+	return nil
+}
+
+// Files returns markdown files recorded in the manifest.
+func (m *Manifest) Files() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var files []string
+	for path := range m.entries {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func (m *Manifest) get(path string) (manifestEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[path]
+	return entry, ok
+}
+
+func (m *Manifest) set(path string, entry manifestEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries[path] = entry
+}
+
+func (m *Manifest) remove(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, path)
+}
+
+// UpToDate reports whether the html file rendered from the markdown file is
+// recorded in the manifest and none of its inputs has changed since then.
+func (r *Renderer) UpToDate(path string) bool {
+	if r.Manifest == nil {
+		return false
+	}
+
+	path = filepath.Clean(path)
+	entry, ok := r.Manifest.get(path)
+	if !ok || entry.Output != outPath(path, r.OutDir, r.BaseDir) || !isFile(entry.Output) {
+		return false
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil || hashBytes(data) != entry.Source {
+		return false
+	}
+	if entry.Config != r.configHash() || entry.Navigation != r.navigationHash(path) {
+		return false
+	}
+	for include, hash := range entry.Includes {
+		if hashFile(include) != hash {
+			return false
+		}
+	}
+
+	// files included are known from the last rendering, and they change
+	// only if the source or one of them changes.
+	r.setIncludes(path, includedFiles(entry.Includes))
+	return true
+}
+
+// record inputs of the file rendered into the manifest
+func (r *Renderer) recordManifest(path string, source []byte, included []string) {
+	if r.Manifest == nil {
+		return
+	}
+
+	path = filepath.Clean(path)
+	entry := manifestEntry{
+		Source:     hashBytes(source),
+		Config:     r.configHash(),
+		Navigation: r.navigationHash(path),
+		Output:     outPath(path, r.OutDir, r.BaseDir),
+	}
+	if len(included) > 0 {
+		entry.Includes = map[string]string{}
+		for _, include := range included {
+			entry.Includes[include] = hashFile(include)
+		}
+	}
+
+	r.Manifest.set(path, entry)
+}
+
+// hash of template, style and options, which affect all files rendered
+func (r *Renderer) configHash() string {
+	r.configOnce.Do(func() {
+		h := sha256.New()
+		fmt.Fprintf(h, "%q\n%q\n", r.Template, r.Style)
+		for _, partial := range r.Partials {
+			content, _ := ioutil.ReadFile(partial)
+			fmt.Fprintf(h, "%q %q\n", partial, content)
+		}
+
+		engine := fmt.Sprintf("%T", r.Engine)
+		if e, ok := r.Engine.(*goldmarkEngine); ok {
+			engine = e.name
+		}
+
+		// maps are printed in key order
+		fmt.Fprintf(h, "%#v\n", []interface{}{
+			r.ImageInline, r.site != nil, r.BaseDir, r.OutDir, engine,
+			r.DiagramCommands, r.PlantUMLServer, r.Math, r.MathAssets, r.Theme,
+			r.CopyButton, r.CollapseButton, r.CodeScript, r.Extensions, r.TOCMinLevel, r.TOCMaxLevel,
+		})
+
+		r.configDigest = hex.EncodeToString(h.Sum(nil))
+	})
+
+	return r.configDigest
+}
+
+// hash of documents and their titles shown in navigation of the file
+func (r *Renderer) navigationHash(path string) string {
+	h := sha256.New()
+
+	if r.site == nil {
+		for _, link := range r.siblings(path) {
+			fmt.Fprintf(h, "%q %q\n", link.Title, link.URL)
+		}
+		return hex.EncodeToString(h.Sum(nil))
+	}
+
+	r.site.mu.Lock()
+	defer r.site.mu.Unlock()
+
+	// navigation of every page depends on the whole site
+	if r.site.digest == "" {
+		for _, f := range r.site.files {
+			fmt.Fprintf(h, "%q %q\n", f, r.site.titles[f])
+		}
+		r.site.digest = hex.EncodeToString(h.Sum(nil))
+	}
+	return r.site.digest
+}
+
+// paths of included files in the manifest entry
+func includedFiles(includes map[string]string) []string {
+	var files []string
+	for include := range includes {
+		files = append(files, include)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hash of the file, or empty if it cannot be read
+func hashFile(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return hashBytes(data)
+}
@@ -0,0 +1,89 @@
+package renderer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpToDate(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	doc := filepath.Join(baseDir, "doc.md")
+	footer := filepath.Join(baseDir, "footer.md")
+	ioutil.WriteFile(doc, []byte("# Doc\n{{< include \"footer.md\" >}}\n"), 0644)
+	ioutil.WriteFile(footer, []byte("footer\n"), 0644)
+
+	newRenderer := func(theme string) *Renderer {
+		manifest, err := LoadManifest(baseDir)
+		if err != nil {
+			t.Fatalf("LoadManifest unexpectedly gave an error: %v", err)
+		}
+		return &Renderer{Template: "{{{content}}}", BaseDir: baseDir, OutDir: baseDir, Theme: theme, Manifest: manifest}
+	}
+
+	r := newRenderer("github")
+	if r.UpToDate(doc) {
+		t.Error("UpToDate returned true for the file never rendered")
+	}
+	if err := r.Render(doc); err != nil {
+		t.Fatalf("Render unexpectedly gave an error: %v", err)
+	}
+	if err := r.Manifest.Save(); err != nil {
+		t.Fatalf("Save unexpectedly gave an error: %v", err)
+	}
+
+	// manifest is kept across builds
+	r = newRenderer("github")
+	if !r.UpToDate(doc) {
+		t.Error("UpToDate returned false for the file unchanged")
+	}
+	if dependents := r.Dependents(footer); len(dependents) != 1 || dependents[0] != doc {
+		t.Errorf("\ngot %v\nwant %v", dependents, []string{doc})
+	}
+
+	// options are inputs as well
+	if newRenderer("monokai").UpToDate(doc) {
+		t.Error("UpToDate returned true after theme is changed")
+	}
+
+	ioutil.WriteFile(footer, []byte("new footer\n"), 0644)
+	if newRenderer("github").UpToDate(doc) {
+		t.Error("UpToDate returned true after included file is changed")
+	}
+	ioutil.WriteFile(footer, []byte("footer\n"), 0644)
+
+	ioutil.WriteFile(filepath.Join(baseDir, "other.md"), []byte("# Other\n"), 0644)
+	if newRenderer("github").UpToDate(doc) {
+		t.Error("UpToDate returned true after a sibling is added")
+	}
+	os.Remove(filepath.Join(baseDir, "other.md"))
+
+	os.Remove(filepath.Join(baseDir, "doc.html"))
+	if newRenderer("github").UpToDate(doc) {
+		t.Error("UpToDate returned true for the file whose output is removed")
+	}
+}
+
+func TestLoadManifest(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	// broken manifest is reported, but an empty one is still usable
+	ioutil.WriteFile(filepath.Join(baseDir, ManifestName), []byte("{"), 0644)
+	m, err := LoadManifest(baseDir)
+	if err == nil {
+		t.Error("LoadManifest gave no error for broken manifest")
+	}
+	if m == nil || len(m.entries) != 0 {
+		t.Errorf("unexpected manifest: %v", m)
+	}
+}
@@ -0,0 +1,361 @@
+package renderer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// KaTeX loaded from CDN when assets are not embedded
+const katexCDN = "https://cdn.jsdelivr.net/npm/katex@0.16.9/dist"
+
+// script rendering math in the page with KaTeX auto-render extension
+const katexRenderScript = `<script>
+document.addEventListener("DOMContentLoaded", function() {
+	renderMathInElement(document.body, {
+		delimiters: [
+			{left: "\\[", right: "\\]", display: true},
+			{left: "\\(", right: "\\)", display: false}
+		]
+	});
+});
+</script>
+`
+
+// token put in place of math while markdown is converted.
+// it consists of letters and digits only so that markdown leaves it alone.
+var mathTokenPattern = regexp.MustCompile(`MDMATH(\d+)X`)
+
+// list item marker at the beginning of a line, such as "- " and "1. "
+var listItemPattern = regexp.MustCompile(`^ {0,3}([-*+]|\d+[.)])(\s|$)`)
+
+// fonts referred from KaTeX stylesheet
+var cssURLPattern = regexp.MustCompile(`url\(["']?([^"')]+)["']?\)`)
+
+// math expression in markdown
+type mathExpr struct {
+	tex     string
+	display bool
+	// math as written in markdown, including delimiters
+	source string
+}
+
+// replace $...$ and $$...$$ in markdown with tokens, so that markdown engine
+// does not treat characters in them as markup. fenced and indented code
+// blocks and code spans are left as they are.
+func protectMath(data []byte) ([]byte, []mathExpr) {
+	var out bytes.Buffer
+	var maths []mathExpr
+
+	// text up to the next code block, in which display math may continue to
+	// following lines
+	var text []byte
+	flush := func() {
+		protected, found := protectMathInText(string(text), len(maths))
+		out.WriteString(protected)
+		maths = append(maths, found...)
+		text = nil
+	}
+
+	fence := ""
+	blank, indentedCode, list := true, false, false
+	for len(data) > 0 {
+		line, rest := splitLine(data)
+		raw := data[:len(data)-len(rest)]
+		data = rest
+		trimmed := strings.TrimSpace(string(line))
+		indented := bytes.HasPrefix(line, []byte("    ")) || bytes.HasPrefix(line, []byte("\t"))
+
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			out.Write(raw)
+			continue
+		case trimmed == "":
+			blank = true
+			text = append(text, raw...)
+			continue
+		case indented && !list && (blank || indentedCode):
+			// indented code block, which cannot interrupt a paragraph and
+			// is a continuation in lists
+			flush()
+			out.Write(raw)
+			blank, indentedCode = false, true
+			continue
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			flush()
+			fence = trimmed[:3]
+			out.Write(raw)
+			blank, indentedCode = false, false
+			continue
+		}
+
+		if listItemPattern.Match(line) {
+			list = true
+		} else if !indented && blank {
+			list = false
+		}
+		blank, indentedCode = false, false
+		text = append(text, raw...)
+	}
+	flush()
+
+	return out.Bytes(), maths
+}
+
+// replace math in text, which does not include code blocks.
+// n is the number of math found so far, used for tokens.
+func protectMathInText(text string, n int) (string, []mathExpr) {
+	var out strings.Builder
+	var maths []mathExpr
+
+	for i := 0; i < len(text); {
+		c := text[i]
+
+		switch {
+		case c == '\\' && i+1 < len(text):
+			// escaped character such as \$
+			out.WriteString(text[i : i+2])
+			i += 2
+			continue
+
+		case c == '`':
+			// code span, which ends with backticks of the same length
+			run := len(text[i:]) - len(strings.TrimLeft(text[i:], "`"))
+			ticks := text[i : i+run]
+			if end := strings.Index(text[i+run:], ticks); end >= 0 {
+				out.WriteString(text[i : i+run+end+run])
+				i += run + end + run
+				continue
+			}
+			out.WriteString(ticks)
+			i += run
+			continue
+
+		case strings.HasPrefix(text[i:], "$$"):
+			if end := strings.Index(text[i+2:], "$$"); end >= 0 {
+				maths = append(maths, mathExpr{
+					tex:     strings.TrimSpace(text[i+2 : i+2+end]),
+					display: true,
+					source:  text[i : i+2+end+2],
+				})
+				fmt.Fprintf(&out, "MDMATH%dX", n+len(maths)-1)
+				i += 2 + end + 2
+				continue
+			}
+
+		case c == '$':
+			if end := inlineMathEnd(text, i); end > 0 {
+				maths = append(maths, mathExpr{tex: text[i+1 : end], source: text[i : end+1]})
+				fmt.Fprintf(&out, "MDMATH%dX", n+len(maths)-1)
+				i = end + 1
+				continue
+			}
+		}
+
+		out.WriteByte(c)
+		i++
+	}
+
+	return out.String(), maths
+}
+
+// find the closing $ of inline math opened at start, or -1.
+// as pandoc does, the opening $ must not be followed by a space, and the
+// closing $ must not be preceded by a space nor followed by a digit, so that
+// prices like $5 and $10 are not treated as math.
+func inlineMathEnd(text string, start int) int {
+	if start+1 >= len(text) || text[start+1] == ' ' || text[start+1] == '\n' {
+		return -1
+	}
+
+	for i := start + 1; i < len(text); i++ {
+		switch text[i] {
+		case '\n':
+			return -1
+		case '\\':
+			i++
+		case '$':
+			if text[i-1] == ' ' || (i+1 < len(text) && text[i+1] >= '0' && text[i+1] <= '9') {
+				continue
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+// put math back into html in place of tokens. tokens in code, raw text and
+// attributes such as link destinations are put back as written in markdown.
+func restoreMath(doc *goquery.Document, maths []mathExpr) {
+	var walk func(n *html.Node, raw bool)
+	walk = func(n *html.Node, raw bool) {
+		for i, attr := range n.Attr {
+			n.Attr[i].Val = restoreMathSource(attr.Val, maths)
+		}
+		switch n.DataAtom {
+		case atom.Code, atom.Pre, atom.Script, atom.Style, atom.Textarea:
+			raw = true
+		}
+
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			switch {
+			case c.Type != html.TextNode:
+				walk(c, raw)
+			case raw:
+				c.Data = restoreMathSource(c.Data, maths)
+			default:
+				restoreMathText(c, maths)
+			}
+			c = next
+		}
+	}
+
+	for _, n := range doc.Nodes {
+		walk(n, false)
+	}
+}
+
+// replace tokens in text with math written in markdown
+func restoreMathSource(text string, maths []mathExpr) string {
+	return mathTokenPattern.ReplaceAllStringFunc(text, func(token string) string {
+		if m, ok := mathToken(token, maths); ok {
+			return m.source
+		}
+		return token
+	})
+}
+
+// replace tokens in the text node with math elements.
+// display math in its own paragraph turns the paragraph into a div.
+func restoreMathText(n *html.Node, maths []mathExpr) {
+	parent := n.Parent
+	if m, ok := mathToken(strings.TrimSpace(n.Data), maths); ok && m.display &&
+		parent.DataAtom == atom.P && parent.FirstChild == n && parent.LastChild == n {
+		parent.DataAtom, parent.Data = atom.Div, "div"
+		parent.Attr = []html.Attribute{{Key: "class", Val: "math display"}}
+		n.Data = `\[` + m.tex + `\]`
+		return
+	}
+
+	indexes := mathTokenPattern.FindAllStringIndex(n.Data, -1)
+	if indexes == nil {
+		return
+	}
+
+	text := n.Data
+	prev := 0
+	for _, index := range indexes {
+		m, ok := mathToken(text[index[0]:index[1]], maths)
+		if !ok {
+			continue
+		}
+		if prev < index[0] {
+			parent.InsertBefore(&html.Node{Type: html.TextNode, Data: text[prev:index[0]]}, n)
+		}
+
+		class, content := "math inline", `\(`+m.tex+`\)`
+		if m.display {
+			class, content = "math display", `\[`+m.tex+`\]`
+		}
+		span := &html.Node{
+			Type:     html.ElementNode,
+			DataAtom: atom.Span,
+			Data:     "span",
+			Attr:     []html.Attribute{{Key: "class", Val: class}},
+		}
+		span.AppendChild(&html.Node{Type: html.TextNode, Data: content})
+		parent.InsertBefore(span, n)
+		prev = index[1]
+	}
+	n.Data = text[prev:]
+	if n.Data == "" {
+		parent.RemoveChild(n)
+	}
+}
+
+// get the math the token stands for
+func mathToken(token string, maths []mathExpr) (mathExpr, bool) {
+	m := mathTokenPattern.FindStringSubmatch(token)
+	if m == nil || m[0] != token {
+		return mathExpr{}, false
+	}
+	i, _ := strconv.Atoi(m[1])
+	if i >= len(maths) {
+		return mathExpr{}, false
+	}
+	return maths[i], true
+}
+
+// get tags loading KaTeX. if the assets directory is specified, KaTeX is
+// embedded so that html can be viewed offline.
+func (r *Renderer) mathScripts() string {
+	r.mathOnce.Do(func() {
+		if r.MathAssets != "" {
+			embedded, err := embedKaTeX(r.MathAssets)
+			if err == nil {
+				r.mathTags = embedded + katexRenderScript
+				return
+			}
+			r.logger().Warn("failed to embed KaTeX, loading it from CDN instead", "dir", r.MathAssets, "error", err)
+		}
+
+		r.mathTags = fmt.Sprintf(`<link rel="stylesheet" href="%[1]s/katex.min.css">
+<script defer src="%[1]s/katex.min.js"></script>
+<script defer src="%[1]s/contrib/auto-render.min.js"></script>
+`, katexCDN) + katexRenderScript
+	})
+
+	return r.mathTags
+}
+
+// create style and script tags including KaTeX distribution in dir.
+// fonts are embedded into the stylesheet as data urls.
+func embedKaTeX(dir string) (string, error) {
+	read := func(name string) (string, error) {
+		content, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return "", errors.Wrap(err, "failed to read KaTeX asset")
+		}
+		return string(content), nil
+	}
+
+	css, err := read("katex.min.css")
+	if err != nil {
+		return "", err
+	}
+	js, err := read("katex.min.js")
+	if err != nil {
+		return "", err
+	}
+	autoRender, err := read("contrib/auto-render.min.js")
+	if err != nil {
+		return "", err
+	}
+
+	css = cssURLPattern.ReplaceAllStringFunc(css, func(u string) string {
+		name := cssURLPattern.FindStringSubmatch(u)[1]
+		font, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			// browsers fall back to other formats listed
+			return u
+		}
+		return fmt.Sprintf("url(data:%s;base64,%s)", mime.TypeByExtension(filepath.Ext(name)), base64.StdEncoding.EncodeToString(font))
+	})
+
+	return "<style>\n" + css + "\n</style>\n<script>\n" + js + "\n</script>\n<script>\n" + autoRender + "\n</script>\n", nil
+}
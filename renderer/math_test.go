@@ -0,0 +1,107 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProtectMath(t *testing.T) {
+	src := "Euler: $e^{i\\pi} + 1 = 0$ costs $5 and $10.\n" +
+		"`$not_math$` and \\$escaped$\n" +
+		"```\n$code_block$\n```\n" +
+		"$$\n\\sum_{i=1}^n a_i\n$$\n" +
+		"\n    x = $a$ + 1\n    $$\n\n- item\n\n    $b$\n"
+
+	protected, maths := protectMath([]byte(src))
+
+	expected := []mathExpr{
+		mathExpr{tex: "e^{i\\pi} + 1 = 0", source: "$e^{i\\pi} + 1 = 0$"},
+		mathExpr{tex: "\\sum_{i=1}^n a_i", display: true, source: "$$\n\\sum_{i=1}^n a_i\n$$"},
+		mathExpr{tex: "b", source: "$b$"},
+	}
+	if len(maths) != len(expected) {
+		t.Fatalf("\ngot %v\nwant %v", maths, expected)
+	}
+	for i := range expected {
+		if maths[i] != expected[i] {
+			t.Errorf("\n%d\ngot %v\nwant %v", i, maths[i], expected[i])
+		}
+	}
+
+	want := "Euler: MDMATH0X costs $5 and $10.\n" +
+		"`$not_math$` and \\$escaped$\n" +
+		"```\n$code_block$\n```\n" +
+		"MDMATH1X\n" +
+		"\n    x = $a$ + 1\n    $$\n\n- item\n\n    MDMATH2X\n"
+	if string(protected) != want {
+		t.Errorf("\ngot %q\nwant %q", string(protected), want)
+	}
+}
+
+func TestRenderMath(t *testing.T) {
+	r := Renderer{Math: true}
+
+	doc, err := r.markdown([]byte("Inline $a_1 < b_2$ here.\n\n$$x_1 * y_1$$\n"))
+	if err != nil {
+		t.Fatalf("markdown unexpectedly gave an error: %v", err)
+	}
+
+	html, _ := doc.Find("body").Html()
+	for _, want := range []string{
+		`<span class="math inline">\(a_1 &lt; b_2\)</span>`,
+		`<div class="math display">\[x_1 * y_1\]</div>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("math not found\nwant %v\nin %v", want, html)
+		}
+	}
+	if strings.Contains(html, "<em>") {
+		t.Errorf("underscores in math are treated as emphasis: %v", html)
+	}
+}
+
+func TestRenderMathKeepsCodeLinksAndHTML(t *testing.T) {
+	r := Renderer{Math: true}
+
+	type TestCase struct {
+		src  string
+		want string
+	}
+
+	cases := []TestCase{
+		TestCase{
+			src:  "text\n\n    x = $a$ + 1\n",
+			want: "<pre><code>x = $a$ + 1\n</code></pre>",
+		},
+		TestCase{
+			src:  "[x](http://a/$b$c)\n",
+			want: `<a href="http://a/$b$c">x</a>`,
+		},
+		TestCase{
+			src:  "<div data-x=\"$a$\">y</div>\n",
+			want: `<div data-x="$a$">y</div>`,
+		},
+		TestCase{
+			src:  "`$a$` and $b$\n",
+			want: `<code>$a$</code> and <span class="math inline">\(b\)</span>`,
+		},
+	}
+
+	for _, c := range cases {
+		doc, err := r.markdown([]byte(c.src))
+		if err != nil {
+			t.Fatalf("markdown unexpectedly gave an error: %v", err)
+		}
+		html, _ := doc.Find("body").Html()
+		if !strings.Contains(html, c.want) {
+			t.Errorf("\n%q\ngot %v\nwant %v", c.src, html, c.want)
+		}
+	}
+}
+
+func TestMathScriptsFallbackToCDN(t *testing.T) {
+	r := Renderer{MathAssets: "directory_not_exists"}
+	if scripts := r.mathScripts(); !strings.Contains(scripts, katexCDN) {
+		t.Errorf("KaTeX is not loaded from CDN: %v", scripts)
+	}
+}
@@ -2,20 +2,21 @@ package renderer
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
+	"html/template"
 	"io"
 	"io/ioutil"
-	"log"
 	"mime"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/pkg/errors"
-	"github.com/russross/blackfriday"
-	"github.com/sourcegraph/syntaxhighlight"
 )
 
 // Renderer support conversion from markdown file into html file
@@ -24,69 +25,298 @@ type Renderer struct {
 	ImageInline bool
 	// html template
 	Template string
+	// partial template files, which can be referred from the template by
+	// their file name without extension
+	Partials []string
 	// css style to be included in html
 	Style string
 	// base directory where markdown files are located
 	BaseDir string
 	// output directory
 	OutDir string
+	// markdown engine. blackfriday is used if nil.
+	Engine MarkdownEngine
+	// commands converting diagram source from stdin into svg, keyed by
+	// language such as "mermaid" and "plantuml". diagrams without command
+	// are rendered in browsers.
+	DiagramCommands map[string]string
+	// PlantUML server used to render diagrams in browsers. diagrams are
+	// sent to no server if empty.
+	PlantUMLServer string
+	// whether $...$ and $$...$$ are rendered as math with KaTeX
+	Math bool
+	// directory of KaTeX distribution, which is embedded into html for
+	// offline use. KaTeX is loaded from CDN if empty.
+	MathAssets string
+	// color theme of syntax highlighting. DefaultTheme is used if empty.
+	Theme string
+	// whether code blocks have a button copying their code
+	CopyButton bool
+	// whether code blocks have a button collapsing them
+	CollapseButton bool
+	// script tag adding buttons to code blocks, which is included in pages
+	// having code blocks when CopyButton or CollapseButton is enabled
+	CodeScript string
+	// extensions of markdown files, which are matched ignoring case.
+	// DefaultExtensions are used if empty.
+	Extensions []string
+	// range of heading levels listed in table of contents. 0 means no limit.
+	TOCMinLevel int
+	TOCMaxLevel int
+	// build manifest, into which inputs of rendered files are recorded.
+	// nothing is recorded if nil.
+	Manifest *Manifest
+	// logger receiving warnings. the standard logger is used if nil.
+	Logger Logger
+
+	site         *site
+	themeOnce    sync.Once
+	themeStyle   string
+	mathOnce     sync.Once
+	mathTags     string
+	templateOnce sync.Once
+	compiled     *template.Template
+	templateErr  error
+	buildTime    time.Time
+	includesMu   sync.Mutex
+	includes     map[string][]string
+	configOnce   sync.Once
+	configDigest string
+}
+
+// Result describes rendering of a markdown file.
+type Result struct {
+	// path of the html file
+	Output string
+	// problems which did not stop rendering, such as images failed to copy
+	Warnings []string
+}
+
+// problems found while rendering a file
+type warnings []string
+
+func (w *warnings) add(format string, a ...interface{}) {
+	*w = append(*w, fmt.Sprintf(format, a...))
+}
+
+// Options describe markdown rendered by RenderBytes and RenderTo.
+type Options struct {
+	// path of the markdown file. relative paths of includes and images are
+	// resolved against it, and links and navigation are created for it if
+	// it is under BaseDir. if empty, they are resolved against the current
+	// directory, and links are not rewritten and navigation is not created.
+	// images are never copied into OutDir, since nothing is written there.
+	Path string
 }
 
 // Render converts markdown to html and write it to file.
+// warnings are written to the logger.
 func (r *Renderer) Render(path string) error {
+	result, err := r.RenderFile(context.Background(), path)
+	for _, w := range result.Warnings {
+		r.logger().Warn(w, "path", path)
+	}
+	return err
+}
+
+// RenderFile converts markdown to html and write it to file, and returns
+// warnings instead of writing them to the logger.
+func (r *Renderer) RenderFile(ctx context.Context, path string) (Result, error) {
+	if _, ok := r.relPath(path); !ok {
+		// there is no place in the output directory for the file
+		return Result{}, errors.Errorf("%s is not under the base directory %s", path, r.BaseDir)
+	}
+
 	outPath := outPath(path, r.OutDir, r.BaseDir)
+	result := Result{Output: outPath}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return result, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	output, w, included, err := r.render(ctx, data, path, true)
+	result.Warnings = w
+	r.setIncludes(path, included)
+	if err != nil {
+		return result, errors.Wrapf(err, "failed to render %s", path)
+	}
 
 	if err := os.MkdirAll(filepath.Dir(outPath), os.ModeDir); err != nil {
-		return errors.Wrapf(err, "failed to create %s", filepath.Dir(outPath))
+		return result, errors.Wrapf(err, "failed to create %s", filepath.Dir(outPath))
+	}
+	err = ioutil.WriteFile(outPath, output, os.ModeAppend)
+	if err != nil {
+		return result, errors.Wrapf(err, "failed to write %s", outPath)
 	}
+	r.recordManifest(path, data, included)
 
-	data, err := ioutil.ReadFile(path)
+	return result, nil
+}
+
+// Remove deletes the html file rendered from the markdown file, which has
+// been removed or renamed, and forgets the file. in site mode, the file is
+// removed from navigation and the index page of its directory is rendered
+// again.
+func (r *Renderer) Remove(path string) error {
+	path = filepath.Clean(path)
+
+	r.includesMu.Lock()
+	delete(r.includes, path)
+	r.includesMu.Unlock()
+	if r.Manifest != nil {
+		r.Manifest.remove(path)
+	}
+
+	outPath := outPath(path, r.OutDir, r.BaseDir)
+	if err := os.Remove(outPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to remove %s", outPath)
+	}
+
+	if r.site == nil {
+		return nil
+	}
+	r.site.remove(path)
+	return r.renderIndex(filepath.Dir(path))
+}
+
+// RenderBytes converts markdown into html of the page.
+// warnings are written to the logger.
+func (r *Renderer) RenderBytes(ctx context.Context, src []byte, opts Options) ([]byte, error) {
+	output, w, _, err := r.render(ctx, src, opts.Path, false)
+	for _, warning := range w {
+		r.logger().Warn(warning, "path", opts.Path)
+	}
+	return output, err
+}
+
+// RenderTo reads markdown from src and writes html of the page to w.
+// warnings are written to the logger.
+func (r *Renderer) RenderTo(ctx context.Context, w io.Writer, src io.Reader, opts Options) error {
+	data, err := ioutil.ReadAll(src)
 	if err != nil {
-		return errors.Wrapf(err, "failed to read %s", path)
+		return errors.Wrap(err, "failed to read markdown")
 	}
 
-	markdowned := blackfriday.MarkdownCommon(data)
+	output, err := r.RenderBytes(ctx, data, opts)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(output); err != nil {
+		return errors.Wrap(err, "failed to write html")
+	}
+	return nil
+}
+
+// convert markdown of the file at path into html of the page. path may be
+// empty for markdown not in a file. images are copied into the output
+// directory if write is true. returns files included and images referenced
+// even if it fails, which the page depends on.
+func (r *Renderer) render(ctx context.Context, data []byte, path string, write bool) ([]byte, warnings, []string, error) {
+	var w warnings
+
+	meta, body, err := parseFrontMatter(data)
+	if err != nil {
+		return nil, w, nil, errors.Wrap(err, "failed to parse front matter")
+	}
+
+	body, included, err := expandIncludes(path, body, nil)
+	if err != nil {
+		return nil, w, included, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, w, included, err
+	}
 
 	// we need document reader to modify markdowned html text, for example,
 	// syntax highlight.
-	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(markdowned))
+	doc, err := r.markdown(body)
 	if err != nil {
-		return errors.Wrapf(err, "failed to parse markdown contents of %s", path)
+		return nil, w, included, errors.Wrap(err, "failed to parse markdown contents")
+	}
+	toc := r.tableOfContents(doc)
+	scripts := r.renderDiagrams(ctx, doc, &w)
+	if doc.Find(".math").Length() > 0 {
+		scripts += r.mathScripts()
+	}
+	r.highlightCode(doc, &w)
+	if r.decorateCode(doc) {
+		scripts += r.CodeScript
+	}
+	if _, ok := r.relPath(path); path != "" && ok {
+		included = append(included, r.handleImage(doc, filepath.Dir(path), write, &w)...)
+		r.rewriteLinks(doc, path)
+	} else if r.ImageInline {
+		// images can be embedded, but there is no place to copy them
+		dir := "."
+		if path != "" {
+			dir = filepath.Dir(path)
+		}
+		r.handleImage(doc, dir, false, &w)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, w, included, err
 	}
-	r.highlightCode(doc)
-	r.handleImage(doc, filepath.Dir(path))
 
 	content, _ := doc.Html()
 	content = strings.Replace(content, "<html><head></head><body>", "", 1)
 	content = strings.Replace(content, "</body></html>", "", 1)
 
-	output := r.Template
-	output = strings.Replace(output, "{{{style}}}", r.Style, -1)
-	output = strings.Replace(output, "{{{content}}}", content, -1)
+	page := r.newPage(path, meta)
+	page.Content = template.HTML(content)
+	page.TOC = template.HTML(toc)
+	page.Scripts = template.HTML(scripts)
 
-	err = ioutil.WriteFile(outPath, []byte(output), os.ModeAppend)
+	output, err := r.execute(page)
 	if err != nil {
-		return errors.Wrapf(err, "failed to write %s", outPath)
+		return nil, w, included, errors.Wrap(err, "failed to execute template")
 	}
 
-	return nil
+	return output, w, included, nil
 }
 
-// highlight inside of code tag
-func (r *Renderer) highlightCode(doc *goquery.Document) {
-	doc.Find("code[class*=\"language-\"]").Each(func(i int, s *goquery.Selection) {
-		oldCode := s.Text()
-		formatted, err := syntaxhighlight.AsHTML([]byte(oldCode))
-		if err != nil {
-			log.Println("WARN : failed to syntax highlight", err)
-			return
+// convert markdown to html document
+func (r *Renderer) markdown(data []byte) (*goquery.Document, error) {
+	engine := r.Engine
+	if engine == nil {
+		engine = blackfridayEngine{}
+	}
+
+	data = extractCodeOptions(data)
+
+	var maths []mathExpr
+	if r.Math {
+		data, maths = protectMath(data)
+	}
+
+	markdowned, err := engine.Convert(data)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(markdowned))
+	if err != nil {
+		return nil, err
+	}
+	if r.Math {
+		restoreMath(doc, maths)
+	}
+	takeCodeOptions(doc)
+	return doc, nil
+}
+
+// include image to html document, or copy images into the output directory
+// if copy is true. returns paths of local images.
+func (r *Renderer) handleImage(doc *goquery.Document, dirPath string, copy bool, w *warnings) []string {
+	var images []string
+	doc.Find("img").Each(func(i int, s *goquery.Selection) {
+		src, _ := s.Attr("src")
+		if src != "" && !strings.HasPrefix(src, "http") && !strings.HasPrefix(src, "data:") {
+			images = append(images, filepath.Join(dirPath, src))
 		}
-		s.SetHtml(string(formatted))
 	})
-}
 
-// include image to html document
-func (r *Renderer) handleImage(doc *goquery.Document, dirPath string) {
 	if r.ImageInline {
 		// include image into html document
 		doc.Find("img").Each(func(i int, s *goquery.Selection) {
@@ -97,11 +327,15 @@ func (r *Renderer) handleImage(doc *goquery.Document, dirPath string) {
 
 			path := filepath.Join(dirPath, src)
 			mime := mime.TypeByExtension(filepath.Ext(path))
-			base64, _ := imageToBase64(path)
+			base64, err := imageToBase64(path)
+			if err != nil {
+				w.add("failed to embed image: %v", err)
+				return
+			}
 			srcEnced := fmt.Sprintf("data:%s;base64,%s", mime, base64)
 			s.SetAttr("src", srcEnced)
 		})
-	} else {
+	} else if rel, ok := r.relPath(dirPath); copy && ok {
 		// move image files to out directory
 		doc.Find("img").Each(func(i int, s *goquery.Selection) {
 			src, _ := s.Attr("src")
@@ -110,25 +344,52 @@ func (r *Renderer) handleImage(doc *goquery.Document, dirPath string) {
 			}
 
 			fromPath := filepath.Join(dirPath, src)
-			toPath := filepath.Join(r.OutDir, dirPath[len(r.BaseDir):], src)
+			toPath := filepath.Join(r.OutDir, rel, src)
 			err := os.MkdirAll(filepath.Dir(toPath), os.ModeDir)
 			if err != nil {
-				log.Println("WARN : failed to create a directory for assets", err)
+				w.add("failed to create a directory for assets: %v", err)
 				return
 			}
 			err = copyFile(fromPath, toPath)
 			if err != nil {
-				log.Println("WARN : failed to copy assets", err)
+				w.add("failed to copy assets: %v", err)
 				return
 			}
 		})
 	}
+
+	return images
+}
+
+// OutputPath returns the path of the html file rendered from the markdown file.
+func (r *Renderer) OutputPath(path string) string {
+	return outPath(path, r.OutDir, r.BaseDir)
+}
+
+// path of the file relative to the base directory. ok is false if the file
+// is not under the base directory, and then it has no place in the output
+// directory.
+func (r *Renderer) relPath(path string) (string, bool) {
+	return relativePath(r.BaseDir, path)
+}
+
+// path relative to dir. ok is false if the path is not dir nor under it.
+func relativePath(dir, path string) (string, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
 }
 
-// get output file name
+// get output file name. files not under the base directory are placed next
+// to themselves.
 func outPath(input, outDir, baseDir string) string {
-	out := filepath.Join(outDir, input[len(baseDir):])
-	return changeExtension(out, "html")
+	rel, ok := relativePath(baseDir, input)
+	if !ok {
+		return changeExtension(input, "html")
+	}
+	return changeExtension(filepath.Join(outDir, rel), "html")
 }
 
 // change extension
@@ -2,9 +2,11 @@ package renderer
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/PuerkitoBio/goquery"
@@ -228,3 +230,160 @@ func TestCopyFile(t *testing.T) {
 		t.Errorf("copyFile did not seem to copy file: %v", statErr)
 	}
 }
+
+func TestRenderBytes(t *testing.T) {
+	r := Renderer{
+		Template: "<title>{{{title}}}</title>\n{{{content}}}",
+		BaseDir:  "/docs",
+		OutDir:   "/out",
+	}
+
+	html, err := r.RenderBytes(context.Background(), []byte("---\ntitle: Memo\n---\n[link](other.md)\n"), Options{})
+	if err != nil {
+		t.Fatalf("RenderBytes unexpectedly gave an error: %v", err)
+	}
+
+	// links are not rewritten without the path of the file
+	expected := "<title>Memo</title>\n<p><a href=\"other.md\">link</a></p>\n"
+	if string(html) != expected {
+		t.Errorf("\ngot %q\nwant %q", string(html), expected)
+	}
+
+	html, err = r.RenderBytes(context.Background(), []byte("[link](other.md)\n"), Options{Path: "/docs/memo.md"})
+	if err != nil {
+		t.Fatalf("RenderBytes unexpectedly gave an error: %v", err)
+	}
+	expected = "<title>memo</title>\n<p><a href=\"other.html\">link</a></p>\n"
+	if string(html) != expected {
+		t.Errorf("\ngot %q\nwant %q", string(html), expected)
+	}
+}
+
+func TestRenderTo(t *testing.T) {
+	r := Renderer{Template: "{{{content}}}"}
+
+	var out bytes.Buffer
+	if err := r.RenderTo(context.Background(), &out, strings.NewReader("# Title\n"), Options{}); err != nil {
+		t.Fatalf("RenderTo unexpectedly gave an error: %v", err)
+	}
+	if expected := "<h1 id=\"title\">Title</h1>\n"; out.String() != expected {
+		t.Errorf("\ngot %q\nwant %q", out.String(), expected)
+	}
+
+	// nothing is written if cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	out.Reset()
+	if err := r.RenderTo(ctx, &out, strings.NewReader("# Title\n"), Options{}); err != context.Canceled {
+		t.Errorf("\ngot %v\nwant %v", err, context.Canceled)
+	}
+	if out.Len() != 0 {
+		t.Errorf("html is written though cancelled: %q", out.String())
+	}
+}
+
+func TestRemove(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	outDir := filepath.Join(baseDir, "out")
+	src := filepath.Join(baseDir, "a.md")
+	image := filepath.Join(baseDir, "image.png")
+	ioutil.WriteFile(src, []byte("![image](image.png)\n"), 0644)
+	ioutil.WriteFile(image, []byte("png"), 0644)
+
+	manifest, _ := LoadManifest(outDir)
+	r := Renderer{Template: "{{{content}}}", BaseDir: baseDir, OutDir: outDir, Manifest: manifest}
+	if err := r.BuildSite([]string{src}); err != nil {
+		t.Fatalf("BuildSite unexpectedly gave an error: %v", err)
+	}
+	if err := r.Render(src); err != nil {
+		t.Fatalf("Render unexpectedly gave an error: %v", err)
+	}
+
+	// the document is rendered again when the image changes
+	if dependents := r.Dependents(image); len(dependents) != 1 || dependents[0] != src {
+		t.Errorf("\ngot %v\nwant %v", dependents, []string{src})
+	}
+
+	os.Remove(src)
+	if err := r.Remove(src); err != nil {
+		t.Fatalf("Remove unexpectedly gave an error: %v", err)
+	}
+
+	if isFile(filepath.Join(outDir, "a.html")) {
+		t.Error("html file of the removed file still exists")
+	}
+	if files := manifest.Files(); len(files) != 0 {
+		t.Errorf("removed file is still recorded in the manifest: %v", files)
+	}
+	if dependents := r.Dependents(image); len(dependents) != 0 {
+		t.Errorf("removed file still depends on the image: %v", dependents)
+	}
+	if index, _ := ioutil.ReadFile(filepath.Join(outDir, "index.html")); strings.Contains(string(index), "a.html") {
+		t.Errorf("removed file is still listed in the index page: %s", index)
+	}
+
+	// removing again is not an error
+	if err := r.Remove(src); err != nil {
+		t.Errorf("Remove unexpectedly gave an error: %v", err)
+	}
+}
+
+func TestRenderOutsideBaseDir(t *testing.T) {
+	r := Renderer{
+		Template: "<title>{{{title}}}</title>\n{{{content}}}",
+		BaseDir:  filepath.Join(string(filepath.Separator)+"docs", "project"),
+		OutDir:   filepath.Join(string(filepath.Separator)+"docs", "out"),
+	}
+
+	type TestCase struct {
+		path     string
+		expected string
+	}
+
+	// links and navigation are not created for files outside the base directory
+	testCases := []TestCase{
+		TestCase{"x.md", "<title>x</title>\n<p><a href=\"other.md\">link</a></p>\n"},
+		TestCase{filepath.Join(string(filepath.Separator)+"docs", "x.md"), "<title>x</title>\n<p><a href=\"other.md\">link</a></p>\n"},
+		TestCase{filepath.Join(string(filepath.Separator)+"docs", "project2", "x.md"), "<title>x</title>\n<p><a href=\"other.md\">link</a></p>\n"},
+	}
+
+	for i, testCase := range testCases {
+		html, err := r.RenderBytes(context.Background(), []byte("[link](other.md)\n"), Options{Path: testCase.path})
+		if err != nil {
+			t.Errorf("\n%d\nRenderBytes unexpectedly gave an error: %v", i, err)
+			continue
+		}
+		if string(html) != testCase.expected {
+			t.Errorf("\n%d\ngot %q\nwant %q", i, string(html), testCase.expected)
+		}
+	}
+
+	// the file has no place in the output directory
+	if _, err := r.RenderFile(context.Background(), "x.md"); err == nil {
+		t.Error("RenderFile rendered a file outside the base directory")
+	}
+}
+
+func TestRenderBytesDoesNotCopyImages(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	outDir := filepath.Join(baseDir, "out")
+	ioutil.WriteFile(filepath.Join(baseDir, "image.png"), []byte("png"), 0644)
+
+	r := Renderer{Template: "{{{content}}}", BaseDir: baseDir, OutDir: outDir}
+	if _, err := r.RenderBytes(context.Background(), []byte("![image](image.png)\n"), Options{Path: filepath.Join(baseDir, "a.md")}); err != nil {
+		t.Fatalf("RenderBytes unexpectedly gave an error: %v", err)
+	}
+	if _, err := os.Stat(outDir); !os.IsNotExist(err) {
+		t.Errorf("output directory is created by RenderBytes: %v", err)
+	}
+}
@@ -0,0 +1,362 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// title of the top page in breadcrumbs
+const siteRootTitle = "Home"
+
+// site holds all markdown files rendered together, to provide navigation
+// between them.
+type site struct {
+	mu sync.RWMutex
+	// markdown files in reading order
+	files []string
+	// title of each markdown file
+	titles map[string]string
+	// hash of files and titles, computed when it is needed
+	digest string
+}
+
+// BuildSite enables site mode. the files are rendered with breadcrumbs and
+// links to the previous and next documents, and RenderIndexes can generate
+// index pages for their directories.
+func (r *Renderer) BuildSite(files []string) error {
+	s := &site{titles: map[string]string{}}
+
+	for _, f := range files {
+		title, err := r.title(f)
+		if err != nil {
+			return err
+		}
+		s.titles[f] = title
+		s.files = append(s.files, f)
+	}
+	sortDocuments(s.files)
+
+	r.site = s
+	return nil
+}
+
+// ShareSite makes the renderer use the site built by another renderer, so
+// that files rendered with different options share navigation.
+func (r *Renderer) ShareSite(other *Renderer) {
+	r.site = other.site
+}
+
+// UpdateSite reflects addition or modification of the markdown file to
+// navigation, and renders the index page of its directory again.
+// changed reports whether the file is new or its title changed, when the
+// previous and next documents need to be rendered again.
+// it does nothing if site mode is not enabled.
+func (r *Renderer) UpdateSite(path string) (changed bool, err error) {
+	if r.site == nil {
+		return false, nil
+	}
+
+	title, err := r.title(path)
+	if err != nil {
+		return false, err
+	}
+
+	r.site.mu.Lock()
+	old, ok := r.site.titles[path]
+	if !ok {
+		r.site.files = append(r.site.files, path)
+		sortDocuments(r.site.files)
+	}
+	r.site.titles[path] = title
+	r.site.digest = ""
+	r.site.mu.Unlock()
+
+	return !ok || old != title, r.renderIndex(filepath.Dir(path))
+}
+
+// Adjacent returns the previous and next documents of the file in reading
+// order, whose navigation links to it. it returns nothing if site mode is
+// not enabled.
+func (r *Renderer) Adjacent(path string) []string {
+	if r.site == nil {
+		return nil
+	}
+
+	s := r.site
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var adjacent []string
+	for i, f := range s.files {
+		if f != path {
+			continue
+		}
+		if i > 0 {
+			adjacent = append(adjacent, s.files[i-1])
+		}
+		if i < len(s.files)-1 {
+			adjacent = append(adjacent, s.files[i+1])
+		}
+		break
+	}
+	return adjacent
+}
+
+// get title of the markdown file, or empty if it is not in the site
+func (s *site) title(path string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.titles[path]
+}
+
+// forget the markdown file removed
+func (s *site) remove(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.titles, path)
+	for i, f := range s.files {
+		if f == path {
+			s.files = append(s.files[:i], s.files[i+1:]...)
+			break
+		}
+	}
+	s.digest = ""
+}
+
+// RenderIndexes writes index.html listing documents for every directory
+// containing markdown files, unless the directory has its own index document
+// such as index.md.
+func (r *Renderer) RenderIndexes() error {
+	if r.site == nil {
+		return nil
+	}
+
+	for _, dir := range r.site.directories(r.BaseDir) {
+		if err := r.renderIndex(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// render index page of the directory
+func (r *Renderer) renderIndex(dir string) error {
+	if r.indexDocument(dir) != "" {
+		// written by the user
+		return nil
+	}
+
+	indexPath := filepath.Join(dir, "index.md")
+	outPath := outPath(indexPath, r.OutDir, r.BaseDir)
+
+	if err := os.MkdirAll(filepath.Dir(outPath), os.ModeDir); err != nil {
+		return errors.Wrapf(err, "failed to create %s", filepath.Dir(outPath))
+	}
+
+	page := r.newPage(indexPath, nil)
+	page.Title = r.directoryTitle(dir)
+	page.Content = template.HTML(r.site.listing(dir, page.Title, r.indexPage))
+
+	output, err := r.execute(page)
+	if err != nil {
+		return errors.Wrapf(err, "failed to render index of %s", dir)
+	}
+
+	err = ioutil.WriteFile(outPath, output, os.ModeAppend)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write %s", outPath)
+	}
+
+	return nil
+}
+
+// get title of a markdown file. it is the title in front matter, the first
+// heading, or the file name, in order of preference.
+func (r *Renderer) title(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	meta, body, err := parseFrontMatter(data)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse front matter of %s", path)
+	}
+	if title := meta.String("title"); title != "" {
+		return title, nil
+	}
+
+	doc, err := r.markdown(body)
+	if err == nil {
+		if h := doc.Find("h1, h2, h3, h4, h5, h6").First(); h.Length() > 0 {
+			if title := strings.TrimSpace(h.Text()); title != "" {
+				return title, nil
+			}
+		}
+	}
+
+	return dropExtension(filepath.Base(path)), nil
+}
+
+// title of a directory used in breadcrumbs and index pages
+func (r *Renderer) directoryTitle(dir string) string {
+	if dir == r.BaseDir {
+		return siteRootTitle
+	}
+	return filepath.Base(dir)
+}
+
+// add site navigation to the page of the markdown file at path
+func (r *Renderer) addNavigation(page *Page, path string) {
+	s := r.site
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	from := filepath.Dir(outPath(path, r.OutDir, r.BaseDir))
+	link := func(target, title string) Link {
+		return Link{
+			Title: title,
+			URL:   relativeURL(from, outPath(target, r.OutDir, r.BaseDir)),
+		}
+	}
+
+	// breadcrumbs of the ancestor directories, from the top
+	dir := filepath.Dir(path)
+	for {
+		index := r.indexPage(dir)
+		if index != path {
+			crumb := link(index, r.directoryTitle(dir))
+			page.Breadcrumbs = append([]Link{crumb}, page.Breadcrumbs...)
+		}
+		if dir == r.BaseDir || !strings.HasPrefix(dir, r.BaseDir) {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	for i, f := range s.files {
+		if f != path {
+			continue
+		}
+		if i > 0 {
+			prev := link(s.files[i-1], s.titles[s.files[i-1]])
+			page.Prev = &prev
+		}
+		if i < len(s.files)-1 {
+			next := link(s.files[i+1], s.titles[s.files[i+1]])
+			page.Next = &next
+		}
+		break
+	}
+
+	for _, f := range s.files {
+		if f != path && filepath.Dir(f) == filepath.Dir(path) {
+			page.Siblings = append(page.Siblings, link(f, s.titles[f]))
+		}
+	}
+}
+
+// directories containing markdown files, including their ancestors up to
+// the base directory.
+func (s *site) directories(baseDir string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	found := map[string]bool{}
+	var dirs []string
+	for _, f := range s.files {
+		for dir := filepath.Dir(f); !found[dir]; dir = filepath.Dir(dir) {
+			found[dir] = true
+			dirs = append(dirs, dir)
+			if dir == baseDir || dir == filepath.Dir(dir) {
+				break
+			}
+		}
+	}
+	sort.Strings(dirs)
+
+	return dirs
+}
+
+// html listing sub directories and documents in dir. sub directories link to
+// their index pages given by indexPage.
+func (s *site) listing(dir, title string, indexPage func(dir string) string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<h1>%s</h1>\n<ul class=\"index\">\n", html.EscapeString(title))
+
+	subdirs := map[string]bool{}
+	for _, f := range s.files {
+		rel, err := filepath.Rel(dir, f)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) > 1 {
+			if !subdirs[parts[0]] {
+				subdirs[parts[0]] = true
+				index := changeExtension(relativeURL(dir, indexPage(filepath.Join(dir, parts[0]))), "html")
+				fmt.Fprintf(&buf, "<li class=\"directory\"><a href=\"%s\">%s/</a></li>\n",
+					html.EscapeString(index), html.EscapeString(parts[0]))
+			}
+			continue
+		}
+
+		fmt.Fprintf(&buf, "<li><a href=\"%s\">%s</a></li>\n",
+			html.EscapeString(changeExtension(parts[0], "html")), html.EscapeString(s.titles[f]))
+	}
+	buf.WriteString("</ul>\n")
+
+	return buf.String()
+}
+
+// sort markdown files in reading order: documents in a directory come before
+// those in its sub directories, and index or readme comes first.
+func sortDocuments(files []string) {
+	sort.SliceStable(files, func(i, j int) bool {
+		di := strings.Split(filepath.ToSlash(filepath.Dir(files[i])), "/")
+		dj := strings.Split(filepath.ToSlash(filepath.Dir(files[j])), "/")
+
+		for k := 0; k < len(di) && k < len(dj); k++ {
+			if di[k] != dj[k] {
+				return di[k] < dj[k]
+			}
+		}
+		if len(di) != len(dj) {
+			// a directory comes before its sub directories
+			return len(di) < len(dj)
+		}
+
+		ni, nj := filepath.Base(files[i]), filepath.Base(files[j])
+		if isIndexDocument(ni) != isIndexDocument(nj) {
+			return isIndexDocument(ni)
+		}
+		return ni < nj
+	})
+}
+
+// see if the file name is index or readme of a directory
+func isIndexDocument(name string) bool {
+	name = strings.ToLower(dropExtension(name))
+	return name == "index" || name == "readme"
+}
+
+// see if a regular file exists at path
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
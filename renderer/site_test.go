@@ -0,0 +1,163 @@
+package renderer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSortDocuments(t *testing.T) {
+	files := []string{
+		filepath.Join("doc", "b", "z.md"),
+		filepath.Join("doc", "z.md"),
+		filepath.Join("doc", "a", "b.md"),
+		filepath.Join("doc", "a", "README.md"),
+		filepath.Join("doc", "a.md"),
+	}
+	sortDocuments(files)
+
+	expected := []string{
+		filepath.Join("doc", "a.md"),
+		filepath.Join("doc", "z.md"),
+		filepath.Join("doc", "a", "README.md"),
+		filepath.Join("doc", "a", "b.md"),
+		filepath.Join("doc", "b", "z.md"),
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("\ngot %v\nwant %v", files, expected)
+	}
+}
+
+func TestSite(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	sources := map[string]string{
+		"first.md":           "# First Document\n",
+		"second.md":          "---\ntitle: Second Document\n---\n# Heading\n",
+		"guide/install.md":   "no heading here\n",
+		"guide/usage/cli.md": "## Command Line\n",
+	}
+	var files []string
+	for name, content := range sources {
+		path := filepath.Join(baseDir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+		files = append(files, path)
+	}
+
+	r := Renderer{
+		Template: "{{{breadcrumb}}}{{{content}}}{{{nav}}}",
+		BaseDir:  baseDir,
+		OutDir:   baseDir,
+	}
+	if err := r.BuildSite(files); err != nil {
+		t.Fatalf("BuildSite unexpectedly gave an error: %v", err)
+	}
+	for _, f := range files {
+		if err := r.Render(f); err != nil {
+			t.Fatalf("Render unexpectedly gave an error: %v", err)
+		}
+	}
+	if err := r.RenderIndexes(); err != nil {
+		t.Fatalf("RenderIndexes unexpectedly gave an error: %v", err)
+	}
+
+	read := func(name string) string {
+		content, err := ioutil.ReadFile(filepath.Join(baseDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatalf("failed to read output %s: %v", name, err)
+		}
+		return string(content)
+	}
+
+	install := read("guide/install.html")
+	for _, want := range []string{
+		`<a href="../index.html">Home</a> / <a href="index.html">guide</a> / <span>install</span>`,
+		`<a class="prev" href="../second.html">&laquo; Second Document</a>`,
+		`<a class="next" href="usage/cli.html">Command Line &raquo;</a>`,
+	} {
+		if !strings.Contains(install, want) {
+			t.Errorf("navigation not found in install.html\nwant %v\nin %v", want, install)
+		}
+	}
+
+	index := read("index.html")
+	for _, want := range []string{
+		`<a href="first.html">First Document</a>`,
+		`<a href="second.html">Second Document</a>`,
+		`<a href="guide/index.html">guide/</a>`,
+	} {
+		if !strings.Contains(index, want) {
+			t.Errorf("link not found in index.html\nwant %v\nin %v", want, index)
+		}
+	}
+
+	// title of the first heading is used in the page as well as navigation
+	cli := read("guide/usage/cli.html")
+	if !strings.Contains(cli, `<span>Command Line</span>`) {
+		t.Errorf("title not found in cli.html: %v", cli)
+	}
+
+	usage := read("guide/usage/index.html")
+	if !strings.Contains(usage, `<a href="cli.html">Command Line</a>`) {
+		t.Errorf("link not found in guide/usage/index.html: %v", usage)
+	}
+}
+
+func TestSiteIndexDocumentCase(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	sub := filepath.Join(baseDir, "sub")
+	os.MkdirAll(sub, 0755)
+	index := filepath.Join(sub, "INDEX.md")
+	page := filepath.Join(sub, "page.md")
+	ioutil.WriteFile(index, []byte("# Sub\n"), 0644)
+	ioutil.WriteFile(page, []byte("# Page\n"), 0644)
+
+	r := Renderer{
+		Template: "{{{breadcrumb}}}{{{content}}}",
+		BaseDir:  baseDir,
+		OutDir:   baseDir,
+	}
+	if err := r.BuildSite([]string{index, page}); err != nil {
+		t.Fatalf("BuildSite unexpectedly gave an error: %v", err)
+	}
+	if err := r.Render(page); err != nil {
+		t.Fatalf("Render unexpectedly gave an error: %v", err)
+	}
+	if err := r.RenderIndexes(); err != nil {
+		t.Fatalf("RenderIndexes unexpectedly gave an error: %v", err)
+	}
+
+	// the index page written by the user is neither overwritten nor doubled
+	if _, err := os.Stat(filepath.Join(sub, "index.html")); err == nil {
+		infos, _ := ioutil.ReadDir(sub)
+		for _, info := range infos {
+			if info.Name() == "index.html" {
+				t.Error("index page is generated though INDEX.md exists")
+			}
+		}
+	}
+
+	content, _ := ioutil.ReadFile(filepath.Join(sub, "page.html"))
+	if !strings.Contains(string(content), `<a href="INDEX.html">sub</a>`) {
+		t.Errorf("breadcrumb does not link to INDEX.html: %s", content)
+	}
+	content, _ = ioutil.ReadFile(filepath.Join(baseDir, "index.html"))
+	if !strings.Contains(string(content), `<a href="sub/INDEX.html">sub/</a>`) {
+		t.Errorf("listing does not link to sub/INDEX.html: %s", content)
+	}
+}
@@ -0,0 +1,284 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Page is the data given to html templates.
+type Page struct {
+	// title of the page. front matter title, or file name if not defined.
+	Title string
+	// path of the html file, relative to the output directory (slash separated)
+	Path string
+	// relative path from the page to the output directory, such as "../.."
+	Root string
+	// style tag
+	Style template.HTML
+	// html converted from markdown
+	Content template.HTML
+	// table of contents
+	TOC template.HTML
+	// scripts the contents need, such as diagram renderers
+	Scripts template.HTML
+	// front matter of the markdown file
+	Meta FrontMatter
+	// time when the build started
+	BuildTime time.Time
+	// other pages in the same directory
+	Siblings []Link
+	// index pages of the ancestor directories, from the top (site mode only)
+	Breadcrumbs []Link
+	// previous and next documents in reading order (site mode only)
+	Prev *Link
+	Next *Link
+}
+
+// Link is a reference to another page.
+type Link struct {
+	// title of the linked page
+	Title string
+	// url relative to the current page
+	URL string
+}
+
+// placeholders of the former template engine, e.g. {{{content}}}
+var placeholderPattern = regexp.MustCompile(`\{\{\{\s*([\w.-]+)\s*\}\}\}`)
+
+// placeholder of scripts
+var scriptsPlaceholderPattern = regexp.MustCompile(`\{\{\{\s*scripts\s*\}\}\}`)
+
+// beginning of go template actions, such as {{.Title}}, {{if ...}} and
+// {{template ...}}. other {{ in legacy templates are text.
+var actionPattern = regexp.MustCompile(`\{\{-?\s*(\.|\$|"|/\*|(define|template|block|if|else|end|range|with|meta|printf|len|index|not|and|or|eq|ne)\b)`)
+
+// templates available from any template. they can be overridden by
+// defining templates of the same names.
+const builtinTemplates = `
+{{- define "breadcrumb" -}}
+{{- if .Breadcrumbs -}}
+<nav class="breadcrumb">
+{{- range .Breadcrumbs}}<a href="{{.URL}}">{{.Title}}</a> / {{end -}}
+<span>{{.Title}}</span></nav>
+{{- end -}}
+{{- end -}}
+
+{{- define "pagenav" -}}
+{{- if or .Prev .Next -}}
+<nav class="pagenav">
+{{- with .Prev}}<a class="prev" href="{{.URL}}">&laquo; {{.Title}}</a>{{end -}}
+{{- with .Next}}<a class="next" href="{{.URL}}">{{.Title}} &raquo;</a>{{end -}}
+</nav>
+{{- end -}}
+{{- end -}}
+`
+
+// functions available in templates
+var templateFuncs = template.FuncMap{
+	// front matter value as text, empty if not defined
+	"meta": func(p *Page, key string) string {
+		return p.Meta.String(key)
+	},
+}
+
+// parse html template and partial templates.
+// placeholders such as {{{content}}} are converted to template actions so
+// that templates written for the former engine keep working.
+func parseTemplate(text string, partials []string) (*template.Template, error) {
+	t := template.New("page").Funcs(templateFuncs)
+	template.Must(t.New("builtin").Parse(builtinTemplates))
+
+	if err := parseText(t, injectScripts(text, true)); err != nil {
+		return nil, errors.Wrap(err, "failed to parse template")
+	}
+
+	for _, path := range partials {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read partial template %s", path)
+		}
+		name := dropExtension(filepath.Base(path))
+		if err := parseText(t.New(name), injectScripts(string(content), false)); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse partial template %s", path)
+		}
+	}
+
+	return t, nil
+}
+
+// parse template text into t. legacy templates, which have placeholders and
+// no template actions, are parsed with the placeholders as delimiters, so
+// that other {{ and }} in them, such as in inline scripts, are left as text.
+func parseText(t *template.Template, text string) error {
+	left, right := "{{", "}}"
+	if isLegacyTemplate(text) {
+		left, right = "{{{", "}}}"
+	}
+
+	_, err := t.Delims(left, right).Parse(convertPlaceholders(text, left, right))
+	return err
+}
+
+// see if the text is written for the former engine
+func isLegacyTemplate(text string) bool {
+	return placeholderPattern.MatchString(text) &&
+		!actionPattern.MatchString(placeholderPattern.ReplaceAllString(text, ""))
+}
+
+// convert {{{key}}} placeholders into template actions with the delimiters
+func convertPlaceholders(text, left, right string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		key := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		return left + placeholderAction(key) + right
+	})
+}
+
+// template action of the placeholder key
+func placeholderAction(key string) string {
+	switch key {
+	case "style":
+		return ".Style"
+	case "content":
+		return ".Content"
+	case "toc":
+		return ".TOC"
+	case "scripts":
+		return ".Scripts"
+	case "title":
+		return ".Title"
+	case "breadcrumb":
+		return `template "breadcrumb" .`
+	case "nav":
+		return `template "pagenav" .`
+	default:
+		return fmt.Sprintf("meta . %q", key)
+	}
+}
+
+// insert scripts the contents need right before the closing body tag, if the
+// template does not place them by itself. if the template has no body tag,
+// they are appended only if always is true, since partial templates without
+// body tag are parts of pages.
+func injectScripts(text string, always bool) string {
+	if strings.Contains(text, ".Scripts") || scriptsPlaceholderPattern.MatchString(text) {
+		return text
+	}
+	i := strings.LastIndex(strings.ToLower(text), "</body>")
+	if i < 0 {
+		if always {
+			return text + "{{{scripts}}}"
+		}
+		return text
+	}
+	return text[:i] + "{{{scripts}}}" + text[i:]
+}
+
+// get the compiled template. it is compiled at the first call.
+func (r *Renderer) template() (*template.Template, error) {
+	r.templateOnce.Do(func() {
+		r.buildTime = time.Now()
+		r.compiled, r.templateErr = parseTemplate(r.Template, r.Partials)
+	})
+	return r.compiled, r.templateErr
+}
+
+// execute the template for the page.
+// if the front matter specifies a layout, the template of that name is used.
+func (r *Renderer) execute(page *Page) ([]byte, error) {
+	t, err := r.template()
+	if err != nil {
+		return nil, err
+	}
+
+	page.BuildTime = r.buildTime
+
+	if layout := page.Meta.String("layout"); layout != "" {
+		t = t.Lookup(layout)
+		if t == nil {
+			return nil, fmt.Errorf("layout not found: %s", layout)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, page); err != nil {
+		return nil, errors.Wrap(err, "failed to execute template")
+	}
+	return buf.Bytes(), nil
+}
+
+// create page context for the markdown file at path. if path is empty or not
+// under the base directory, the page has neither its path nor navigation.
+func (r *Renderer) newPage(path string, meta FrontMatter) *Page {
+	title := meta.String("title")
+	if title == "" && r.site != nil {
+		// the same title as navigation of other pages shows
+		title = r.site.title(path)
+	}
+	if title == "" && path != "" {
+		title = dropExtension(filepath.Base(path))
+	}
+
+	if _, ok := r.relPath(path); path == "" || !ok {
+		return &Page{
+			Title: title,
+			Root:  ".",
+			Style: template.HTML(r.Style + r.highlightStyle()),
+			Meta:  meta,
+		}
+	}
+
+	out := outPath(path, r.OutDir, r.BaseDir)
+
+	page := &Page{
+		Title: title,
+		Path:  relativeURL(r.OutDir, out),
+		Root:  relativeURL(filepath.Dir(out), r.OutDir),
+		Style: template.HTML(r.Style + r.highlightStyle()),
+		Meta:  meta,
+	}
+	if r.site != nil {
+		r.addNavigation(page, path)
+	} else {
+		page.Siblings = r.siblings(path)
+	}
+
+	return page
+}
+
+// list markdown files in the same directory as path as links, sorted by name
+func (r *Renderer) siblings(path string) []Link {
+	infos, err := ioutil.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil
+	}
+
+	var links []Link
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !r.isMarkdown(name) || name == filepath.Base(path) {
+			continue
+		}
+		links = append(links, Link{
+			Title: dropExtension(name),
+			URL:   changeExtension(name, "html"),
+		})
+	}
+	return links
+}
+
+// relative path from base to target, slash separated to be used in html
+func relativeURL(base, target string) string {
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		return filepath.ToSlash(target)
+	}
+	return filepath.ToSlash(rel)
+}
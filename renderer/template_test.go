@@ -0,0 +1,164 @@
+package renderer
+
+import (
+	"html/template"
+	"testing"
+)
+
+func TestConvertPlaceholders(t *testing.T) {
+	got := convertPlaceholders("<title>{{{title}}}</title>{{{style}}}{{{ content }}}{{{author}}}", "{{", "}}")
+	want := `<title>{{.Title}}</title>{{.Style}}{{.Content}}{{meta . "author"}}`
+	if got != want {
+		t.Errorf("\ngot %v\nwant %v", got, want)
+	}
+}
+
+func TestExecuteLegacyTemplate(t *testing.T) {
+	r := Renderer{
+		Template: "<title>{{{title}}}</title>{{{style}}}{{{author}}}|{{{date}}}|{{{content}}}",
+	}
+
+	page := &Page{
+		Title:   "A & B",
+		Style:   template.HTML("<style></style>"),
+		Content: template.HTML("<p>{{{author}}}</p>"),
+		Meta:    FrontMatter{"author": "<taq-f>"},
+	}
+
+	got, err := r.execute(page)
+	if err != nil {
+		t.Fatalf("execute unexpectedly gave an error: %v", err)
+	}
+
+	// front matter is escaped, contents are left as they are.
+	want := "<title>A &amp; B</title><style></style>&lt;taq-f&gt;||<p>{{{author}}}</p>"
+	if string(got) != want {
+		t.Errorf("\ngot %v\nwant %v", string(got), want)
+	}
+}
+
+func TestExecuteLegacyTemplateWithBraces(t *testing.T) {
+	r := Renderer{
+		Template: "<script>var x = {{a:1}};</script>{{{title}}}|{{{content}}}|{{ mustache }}",
+	}
+
+	page := &Page{
+		Title:   "A",
+		Content: template.HTML("<p>hi</p>"),
+	}
+
+	got, err := r.execute(page)
+	if err != nil {
+		t.Fatalf("execute unexpectedly gave an error: %v", err)
+	}
+
+	// braces other than placeholders are left as text
+	want := "<script>var x = {{a:1}};</script>A|<p>hi</p>|{{ mustache }}"
+	if string(got) != want {
+		t.Errorf("\ngot %v\nwant %v", string(got), want)
+	}
+}
+
+func TestIsLegacyTemplate(t *testing.T) {
+	type TestCase struct {
+		text   string
+		legacy bool
+	}
+
+	cases := []TestCase{
+		TestCase{text: "{{{content}}}", legacy: true},
+		TestCase{text: "<script>var x = {{a:1}};</script>{{{content}}}", legacy: true},
+		TestCase{text: "{{.Content}}", legacy: false},
+		TestCase{text: "{{if .Title}}{{{title}}}{{end}}{{{content}}}", legacy: false},
+		TestCase{text: `{{template "pagenav" .}}{{{content}}}`, legacy: false},
+	}
+
+	for _, c := range cases {
+		if got := isLegacyTemplate(c.text); got != c.legacy {
+			t.Errorf("\n%s\ngot %v\nwant %v", c.text, got, c.legacy)
+		}
+	}
+}
+
+func TestInjectScripts(t *testing.T) {
+	type TestCase struct {
+		text   string
+		always bool
+		want   string
+	}
+
+	cases := []TestCase{
+		TestCase{
+			text:   "<body>{{.Content}}</BODY></html>",
+			always: false,
+			want:   "<body>{{.Content}}{{{scripts}}}</BODY></html>",
+		},
+		TestCase{
+			text:   "<head>{{.Scripts}}</head><body></body>",
+			always: true,
+			want:   "<head>{{.Scripts}}</head><body></body>",
+		},
+		TestCase{
+			text:   "{{.Content}}",
+			always: true,
+			want:   "{{.Content}}{{{scripts}}}",
+		},
+		TestCase{
+			text:   "<nav></nav>",
+			always: false,
+			want:   "<nav></nav>",
+		},
+	}
+
+	for _, c := range cases {
+		if got := injectScripts(c.text, c.always); got != c.want {
+			t.Errorf("\ngot %v\nwant %v", got, c.want)
+		}
+	}
+}
+
+func TestExecuteCustomTemplateScripts(t *testing.T) {
+	r := Renderer{
+		Template: "<html><body>{{{content}}}</body></html>",
+	}
+
+	page := &Page{
+		Content: template.HTML("<p>hi</p>"),
+		Scripts: template.HTML("<script></script>"),
+	}
+
+	got, err := r.execute(page)
+	if err != nil {
+		t.Fatalf("execute unexpectedly gave an error: %v", err)
+	}
+
+	// scripts are injected even though the template has no placeholder for them
+	want := "<html><body><p>hi</p><script></script></body></html>"
+	if string(got) != want {
+		t.Errorf("\ngot %v\nwant %v", string(got), want)
+	}
+}
+
+func TestExecuteLayout(t *testing.T) {
+	r := Renderer{
+		Template: `{{define "slide"}}<section>{{.Content}}</section>{{end}}<article>{{.Content}}</article>`,
+	}
+
+	page := &Page{
+		Content: template.HTML("<p>hi</p>"),
+		Meta:    FrontMatter{"layout": "slide"},
+	}
+
+	got, err := r.execute(page)
+	if err != nil {
+		t.Fatalf("execute unexpectedly gave an error: %v", err)
+	}
+	if string(got) != "<section><p>hi</p></section>" {
+		t.Errorf("\ngot %v\nwant %v", string(got), "<section><p>hi</p></section>")
+	}
+
+	page.Meta = FrontMatter{"layout": "unknown"}
+	if _, err := r.execute(page); err == nil {
+		t.Error("execute gave no error even though the layout does not exist")
+	}
+}
@@ -0,0 +1,152 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// inline marker replaced with table of contents
+const tocMarker = "[TOC]"
+
+// heading in a document
+type heading struct {
+	level int
+	id    string
+	text  string
+}
+
+// assign ids to headings which do not have one yet, and collect headings.
+//
+// ids are made from heading texts in the same manner as GitHub does, so that
+// links to sections keep working as long as the heading text is the same.
+func assignHeadingIDs(doc *goquery.Document) []heading {
+	// ids written by hand must not be used for generated ones
+	used := map[string]bool{}
+	doc.Find("[id]").Each(func(i int, s *goquery.Selection) {
+		id, _ := s.Attr("id")
+		used[id] = true
+	})
+
+	var headings []heading
+	doc.Find("h1, h2, h3, h4, h5, h6").Each(func(i int, s *goquery.Selection) {
+		text := strings.TrimSpace(s.Text())
+		id, ok := s.Attr("id")
+		if !ok || id == "" {
+			id = uniqueID(slugify(text), used)
+			s.SetAttr("id", id)
+		}
+
+		headings = append(headings, heading{
+			level: int(goquery.NodeName(s)[1] - '0'),
+			id:    id,
+			text:  text,
+		})
+	})
+
+	return headings
+}
+
+// make url fragment from heading text.
+// letters and digits of any language are kept, spaces become hyphens and
+// other symbols are dropped.
+func slugify(text string) string {
+	var buf bytes.Buffer
+	for _, c := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(c) || unicode.IsDigit(c) || c == '-' || c == '_':
+			buf.WriteRune(c)
+		case unicode.IsSpace(c):
+			buf.WriteRune('-')
+		}
+	}
+
+	if buf.Len() == 0 {
+		return "section"
+	}
+	return buf.String()
+}
+
+// add suffix to id if it is already used, e.g. "setup-1"
+func uniqueID(id string, used map[string]bool) string {
+	unique := id
+	for i := 1; used[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d", id, i)
+	}
+	used[unique] = true
+	return unique
+}
+
+// create nested list of headings whose level is between min and max.
+// empty string is returned if no heading is in the range.
+func tocHTML(headings []heading, min, max int) string {
+	var buf bytes.Buffer
+
+	// levels of lists currently open
+	var levels []int
+
+	for _, h := range headings {
+		if h.level < min || h.level > max {
+			continue
+		}
+
+		switch {
+		case len(levels) == 0:
+			buf.WriteString("<ul>")
+			levels = append(levels, h.level)
+		case h.level > levels[len(levels)-1]:
+			// nested in the list item currently open
+			buf.WriteString("<ul>")
+			levels = append(levels, h.level)
+		default:
+			// close lists deeper than the heading, but not the one of the
+			// parent heading
+			for len(levels) > 1 && h.level <= levels[len(levels)-2] {
+				buf.WriteString("</li></ul>")
+				levels = levels[:len(levels)-1]
+			}
+			// the list may have skipped levels, such as h3 under h1 followed
+			// by h2, which becomes a sibling of the h3
+			if h.level < levels[len(levels)-1] {
+				levels[len(levels)-1] = h.level
+			}
+			buf.WriteString("</li>")
+		}
+
+		fmt.Fprintf(&buf, `<li><a href="#%s">%s</a>`, html.EscapeString(h.id), html.EscapeString(h.text))
+	}
+
+	if len(levels) == 0 {
+		return ""
+	}
+	for range levels {
+		buf.WriteString("</li></ul>")
+	}
+
+	return `<nav class="toc">` + buf.String() + "</nav>"
+}
+
+// create table of contents of the document and put it where [TOC] marker is
+func (r *Renderer) tableOfContents(doc *goquery.Document) string {
+	min, max := r.TOCMinLevel, r.TOCMaxLevel
+	if min <= 0 {
+		min = 1
+	}
+	if max <= 0 {
+		max = 6
+	}
+
+	toc := tocHTML(assignHeadingIDs(doc), min, max)
+
+	doc.Find("p").Each(func(i int, s *goquery.Selection) {
+		if strings.TrimSpace(s.Text()) == tocMarker {
+			s.ReplaceWithHtml(toc)
+		}
+	})
+
+	return toc
+}
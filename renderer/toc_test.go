@@ -0,0 +1,120 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestSlugify(t *testing.T) {
+	type TestCase struct {
+		text     string
+		expected string
+	}
+
+	testCases := []TestCase{
+		TestCase{"Getting Started", "getting-started"},
+		TestCase{"What's new in v1.2?", "whats-new-in-v12"},
+		TestCase{"snake_case and kebab-case", "snake_case-and-kebab-case"},
+		TestCase{"はじめに", "はじめに"},
+		TestCase{"!!!", "section"},
+	}
+
+	for i, testCase := range testCases {
+		got := slugify(testCase.text)
+		if got != testCase.expected {
+			t.Errorf("\n%d\ngot %v\nwant %v", i, got, testCase.expected)
+		}
+	}
+}
+
+func TestAssignHeadingIDs(t *testing.T) {
+	src := `<h1>Setup</h1><h2 id="setup">Custom</h2><h2>Setup</h2><h3>Setup</h3>`
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(src))
+
+	headings := assignHeadingIDs(doc)
+
+	expected := []heading{
+		heading{1, "setup-1", "Setup"},
+		heading{2, "setup", "Custom"},
+		heading{2, "setup-2", "Setup"},
+		heading{3, "setup-3", "Setup"},
+	}
+	if len(headings) != len(expected) {
+		t.Fatalf("\ngot %v\nwant %v", headings, expected)
+	}
+	for i := range expected {
+		if headings[i] != expected[i] {
+			t.Errorf("\n%d\ngot %v\nwant %v", i, headings[i], expected[i])
+		}
+	}
+}
+
+func TestTOCHTML(t *testing.T) {
+	headings := []heading{
+		heading{1, "a", "A"},
+		heading{2, "b", "B"},
+		heading{3, "c", "C"},
+		heading{2, "d", "D"},
+		heading{1, "e", "E & F"},
+	}
+
+	got := tocHTML(headings, 1, 6)
+	want := `<nav class="toc"><ul>` +
+		`<li><a href="#a">A</a><ul>` +
+		`<li><a href="#b">B</a><ul><li><a href="#c">C</a></li></ul></li>` +
+		`<li><a href="#d">D</a></li></ul></li>` +
+		`<li><a href="#e">E &amp; F</a></li>` +
+		`</ul></nav>`
+	if got != want {
+		t.Errorf("\ngot %v\nwant %v", got, want)
+	}
+
+	got = tocHTML(headings, 2, 2)
+	want = `<nav class="toc"><ul><li><a href="#b">B</a></li><li><a href="#d">D</a></li></ul></nav>`
+	if got != want {
+		t.Errorf("\ngot %v\nwant %v", got, want)
+	}
+
+	if got = tocHTML(headings, 4, 6); got != "" {
+		t.Errorf("\ngot %v\nwant empty", got)
+	}
+
+	// skipped levels are nested under the heading above
+	skipped := []heading{
+		heading{1, "a", "A"},
+		heading{3, "b", "B"},
+		heading{2, "c", "C"},
+		heading{3, "d", "D"},
+		heading{1, "e", "E"},
+	}
+	got = tocHTML(skipped, 1, 6)
+	want = `<nav class="toc"><ul>` +
+		`<li><a href="#a">A</a><ul>` +
+		`<li><a href="#b">B</a></li>` +
+		`<li><a href="#c">C</a><ul><li><a href="#d">D</a></li></ul></li></ul></li>` +
+		`<li><a href="#e">E</a></li>` +
+		`</ul></nav>`
+	if got != want {
+		t.Errorf("\ngot %v\nwant %v", got, want)
+	}
+}
+
+func TestTableOfContentsMarker(t *testing.T) {
+	src := `<p>[TOC]</p><h1>Title</h1><h2>Section</h2>`
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(src))
+
+	r := Renderer{TOCMinLevel: 2}
+	toc := r.tableOfContents(doc)
+
+	if doc.Find("p").Length() != 0 {
+		t.Error("[TOC] marker was not replaced")
+	}
+	if doc.Find("nav.toc a[href=\"#section\"]").Length() != 1 {
+		t.Error("table of contents was not inserted at the marker")
+	}
+	if strings.Contains(toc, "#title") {
+		t.Errorf("heading out of level range is listed: %v", toc)
+	}
+}
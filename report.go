@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// formats of build report
+const reportJSON = "json"
+
+// statuses of files in build report
+const (
+	statusSuccess = "success"
+	statusSkipped = "skipped"
+	statusFailed  = "failed"
+)
+
+// build report written for CI
+type buildReport struct {
+	Summary reportSummary `json:"summary"`
+	Files   []fileReport  `json:"files"`
+}
+
+type reportSummary struct {
+	All        int     `json:"all"`
+	Success    int     `json:"success"`
+	Skipped    int     `json:"skipped"`
+	Failed     int     `json:"failed"`
+	DurationMS float64 `json:"duration_ms"`
+	// errors not related to a file, such as failure of writing index pages
+	Errors []string `json:"errors,omitempty"`
+}
+
+// result of a markdown file in build report
+type fileReport struct {
+	Path       string   `json:"path"`
+	Status     string   `json:"status"`
+	DurationMS float64  `json:"duration_ms"`
+	Output     string   `json:"output"`
+	Warnings   []string `json:"warnings"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// add result of a file to the report
+func (b *buildReport) add(result renderResult) {
+	file := fileReport{
+		Path:       result.file,
+		Status:     statusSuccess,
+		DurationMS: milliseconds(result.duration),
+		Output:     result.output,
+		Warnings:   result.warnings,
+	}
+	if file.Warnings == nil {
+		// empty array is easier to handle than null
+		file.Warnings = []string{}
+	}
+
+	b.Summary.All++
+	switch {
+	case result.skipped:
+		file.Status = statusSkipped
+		b.Summary.Skipped++
+	case result.err != nil:
+		file.Status = statusFailed
+		file.Error = result.err.Error()
+		b.Summary.Failed++
+	default:
+		b.Summary.Success++
+	}
+
+	b.Files = append(b.Files, file)
+}
+
+// write the report in JSON. files are sorted by path, since they are added
+// in the order of completion.
+func (b *buildReport) writeJSON(w io.Writer) error {
+	sort.Slice(b.Files, func(i, j int) bool { return b.Files[i].Path < b.Files[j].Path })
+	if b.Files == nil {
+		b.Files = []fileReport{}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(b)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// write the report to the file, or stdout if path is empty
+func writeReport(report *buildReport, path string) error {
+	if path == "" {
+		return report.writeJSON(os.Stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := report.writeJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
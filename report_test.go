@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildReport(t *testing.T) {
+	report := buildReport{}
+	report.add(renderResult{file: "/docs/b.md", output: "/out/b.html", warnings: []string{"failed to copy assets"}, duration: 1500 * time.Microsecond})
+	report.add(renderResult{file: "/docs/c.md", err: errors.New("failed to read /docs/c.md")})
+	report.add(renderResult{file: "/docs/a.md", output: "/out/a.html", skipped: true})
+
+	var buf bytes.Buffer
+	if err := report.writeJSON(&buf); err != nil {
+		t.Fatalf("writeJSON unexpectedly gave an error: %v", err)
+	}
+
+	var actual map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &actual); err != nil {
+		t.Fatalf("report is not valid JSON: %v: %s", err, buf.String())
+	}
+
+	expected := map[string]interface{}{
+		"summary": map[string]interface{}{
+			"all": 3.0, "success": 1.0, "skipped": 1.0, "failed": 1.0, "duration_ms": 0.0,
+		},
+		"files": []interface{}{
+			map[string]interface{}{
+				"path": "/docs/a.md", "status": "skipped", "duration_ms": 0.0,
+				"output": "/out/a.html", "warnings": []interface{}{},
+			},
+			map[string]interface{}{
+				"path": "/docs/b.md", "status": "success", "duration_ms": 1.5,
+				"output": "/out/b.html", "warnings": []interface{}{"failed to copy assets"},
+			},
+			map[string]interface{}{
+				"path": "/docs/c.md", "status": "failed", "duration_ms": 0.0,
+				"output": "", "warnings": []interface{}{}, "error": "failed to read /docs/c.md",
+			},
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("\ngot %v\nwant %v", actual, expected)
+	}
+}
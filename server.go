@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// path of the server-sent events endpoint browsers listen on for reloads
+const reloadPath = "/__reload"
+
+// script injected into every page in serve mode. it reloads the page when
+// the server notifies that some file has been re-rendered.
+const reloadScript = `<script>
+(function() {
+	if (!window.EventSource) {
+		return;
+	}
+	var source = new EventSource("` + reloadPath + `");
+	source.onmessage = function() {
+		location.reload();
+	};
+})();
+</script>
+`
+
+// reloadBroker delivers reload notifications to connected browsers.
+type reloadBroker struct {
+	mu      sync.Mutex
+	clients map[chan string]bool
+}
+
+func newReloadBroker() *reloadBroker {
+	return &reloadBroker{clients: map[chan string]bool{}}
+}
+
+// notify all connected browsers that path has been re-rendered.
+func (b *reloadBroker) notify(path string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for c := range b.clients {
+		select {
+		case c <- path:
+		default:
+			// the client has not received the previous notification yet.
+			// reloading once is enough, so drop this one.
+		}
+	}
+}
+
+func (b *reloadBroker) subscribe() chan string {
+	c := make(chan string, 1)
+	b.mu.Lock()
+	b.clients[c] = true
+	b.mu.Unlock()
+	return c
+}
+
+func (b *reloadBroker) unsubscribe(c chan string) {
+	b.mu.Lock()
+	delete(b.clients, c)
+	b.mu.Unlock()
+}
+
+// ServeHTTP streams reload notifications as server-sent events.
+func (b *reloadBroker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	c := b.subscribe()
+	defer b.unsubscribe(c)
+
+	// some proxies close idle connections, so send a comment periodically.
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case path := <-c:
+			fmt.Fprintf(w, "data: %s\n\n", path)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+// serve html files under dir and reload notifications on addr.
+// this function blocks until the server stops.
+func serve(addr, dir string, broker *reloadBroker) error {
+	mux := http.NewServeMux()
+	mux.Handle(reloadPath, broker)
+	mux.Handle("/", http.FileServer(http.Dir(dir)))
+
+	return http.ListenAndServe(addr, mux)
+}
+
+// insert script right before the closing body tag of the template.
+// if the template has no body tag, the script is appended.
+func injectScript(template, script string) string {
+	i := strings.LastIndex(strings.ToLower(template), "</body>")
+	if i < 0 {
+		return template + script
+	}
+	return template[:i] + script + template[i:]
+}
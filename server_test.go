@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestInjectScript(t *testing.T) {
+	type TestCase struct {
+		template string
+		expected string
+	}
+
+	testCases := []TestCase{
+		TestCase{
+			"<html><body>{{{content}}}</body></html>",
+			"<html><body>{{{content}}}<script></script></body></html>",
+		},
+		TestCase{
+			"<HTML><BODY>{{{content}}}</BODY></HTML>",
+			"<HTML><BODY>{{{content}}}<script></script></BODY></HTML>",
+		},
+		TestCase{
+			"{{{content}}}",
+			"{{{content}}}<script></script>",
+		},
+	}
+
+	for i, testCase := range testCases {
+		got := injectScript(testCase.template, "<script></script>")
+		if got != testCase.expected {
+			t.Errorf("\n%d\ngot %v\nwant %v", i, got, testCase.expected)
+		}
+	}
+}
+
+func TestReloadBrokerNotify(t *testing.T) {
+	broker := newReloadBroker()
+	c := broker.subscribe()
+
+	broker.notify("foo.md")
+	// the second notification must not block even though nobody receives it.
+	broker.notify("bar.md")
+
+	if got := <-c; got != "foo.md" {
+		t.Errorf("\ngot %v\nwant %v", got, "foo.md")
+	}
+
+	broker.unsubscribe(c)
+	broker.notify("baz.md")
+	if len(c) != 0 {
+		t.Error("notification was delivered to an unsubscribed client")
+	}
+}
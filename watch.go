@@ -0,0 +1,382 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-fsnotify/fsnotify"
+	exists "github.com/taq-f/go-exists"
+	"github.com/taq-f/miniature-potato/renderer"
+)
+
+// delay after the last event on a file before it is handled. saving a file
+// causes several events in a very short time, and editors often save by
+// writing a temporary file and renaming it.
+const debounceDelay = 200 * time.Millisecond
+
+// debounceQueue holds paths having events until no more event occurs on
+// them for the delay.
+type debounceQueue struct {
+	delay time.Duration
+	now   func() time.Time
+	// time when each path is due
+	pending map[string]time.Time
+}
+
+func newDebounceQueue(delay time.Duration) *debounceQueue {
+	return &debounceQueue{delay: delay, now: time.Now, pending: map[string]time.Time{}}
+}
+
+// add the path, or postpone it if it is already queued
+func (q *debounceQueue) add(path string) {
+	q.pending[path] = q.now().Add(q.delay)
+}
+
+// take paths which are due, sorted
+func (q *debounceQueue) due() []string {
+	now := q.now()
+
+	var paths []string
+	for path, t := range q.pending {
+		if !t.After(now) {
+			paths = append(paths, path)
+			delete(q.pending, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// duration until the next path is due. ok is false if the queue is empty.
+func (q *debounceQueue) next() (d time.Duration, ok bool) {
+	for _, t := range q.pending {
+		if wait := t.Sub(q.now()); !ok || wait < d {
+			d, ok = wait, true
+		}
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d, ok
+}
+
+// watcher renders markdown files as they are modified, and removes html
+// files of markdown files removed or renamed.
+type watcher struct {
+	// input directory, or the input file
+	root      string
+	renderers *renderers
+	// files and directories the filter rejects are not watched
+	filter *fileFilter
+	// files read when renderers are created, such as template and style sheet
+	assets []string
+	// glob patterns of partial templates. partials are found again when
+	// renderers are created, so that partials added or removed are handled.
+	partials []string
+	// creates renderers again when one of assets changes
+	reload func(prev *renderers) (*renderers, error)
+	// called with the path of each file rendered, if not nil
+	onRender func(string)
+
+	fsw *fsnotify.Watcher
+	// directories watched
+	dirs map[string]bool
+}
+
+// run watches files until the watcher is closed. errors of watching are
+// logged, and watching continues.
+func (w *watcher) run() {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Fatal("failed to start watching", "error", err)
+	}
+	defer fsw.Close()
+	w.init(fsw)
+
+	queue := newDebounceQueue(debounceDelay)
+	var wait <-chan time.Time
+
+	for {
+		select {
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				// contents are unchanged
+				continue
+			}
+			queue.add(event.Name)
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return
+			}
+			// such as overflow of events, which may miss some changes but
+			// does not break the watcher
+			logger.Error("watch error", "error", err)
+		case <-wait:
+			w.handle(queue.due())
+		}
+
+		wait = nil
+		if d, ok := queue.next(); ok {
+			wait = time.After(d)
+		}
+	}
+}
+
+// start watching the root, and files rendered files depend on
+func (w *watcher) init(fsw *fsnotify.Watcher) {
+	w.fsw = fsw
+	w.dirs = map[string]bool{}
+
+	if isDir(w.root) {
+		for _, dir := range getDirectories(w.root, w.filter) {
+			w.watchDir(dir)
+		}
+	} else {
+		w.watchDir(filepath.Dir(w.root))
+	}
+	w.watchDependencies()
+}
+
+// handle paths which had events. each path is handled by its current state,
+// so that a file renamed is removed at the old path and rendered at the new
+// one.
+func (w *watcher) handle(paths []string) {
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		switch {
+		case w.isAsset(path):
+			// the file being replaced is handled when it is created again,
+			// while partials may be removed for good
+			if err == nil || w.isPartial(path) {
+				w.reloadAll(path)
+			}
+		case err != nil:
+			w.removed(path)
+		case info.IsDir():
+			w.created(path)
+		default:
+			w.modified(path)
+		}
+	}
+
+	w.watchDependencies()
+	if m := w.renderers.root.Manifest; m != nil {
+		if err := m.Save(); err != nil {
+			logger.Warn("failed to write manifest", "error", err)
+		}
+	}
+}
+
+// render the file modified or created, and documents depending on it
+func (w *watcher) modified(path string) {
+	target := w.isTarget(path)
+	dependents := w.renderers.Dependents(path)
+	if !target && len(dependents) == 0 {
+		return
+	}
+
+	logger.Info("modification detected", "path", path)
+	if target {
+		w.render(path)
+	}
+	for _, dependent := range dependents {
+		if dependent != path {
+			w.render(dependent)
+		}
+	}
+}
+
+// remove html files of the file or directory removed, and render documents
+// depending on it again to report it missing
+func (w *watcher) removed(path string) {
+	if w.dirs[path] {
+		logger.Info("removal detected", "path", path)
+		for dir := range w.dirs {
+			if isUnder(path, dir) {
+				// the watch may have gone with the directory
+				w.fsw.Remove(dir)
+				delete(w.dirs, dir)
+			}
+		}
+		if m := w.renderers.root.Manifest; m != nil {
+			for _, f := range m.Files() {
+				if isUnder(path, f) {
+					w.remove(f)
+				}
+			}
+		}
+		return
+	}
+
+	markdown := renderer.IsMarkdown(path, w.extensions()) && isUnder(w.root, path) && w.filter.allowFile(path)
+	dependents := w.renderers.Dependents(path)
+	if !markdown && len(dependents) == 0 {
+		return
+	}
+
+	logger.Info("removal detected", "path", path)
+	if markdown {
+		w.remove(path)
+	}
+	for _, dependent := range dependents {
+		if dependent != path {
+			w.render(dependent)
+		}
+	}
+}
+
+// watch the directory created or moved into the root, and render markdown
+// files in it
+func (w *watcher) created(dir string) {
+	if w.dirs[dir] || !isUnder(w.root, dir) || !w.filter.allowDir(dir) {
+		return
+	}
+
+	logger.Info("new directory detected", "path", dir)
+	for _, d := range getDirectories(dir, w.filter) {
+		w.watchDir(d)
+	}
+
+	files, err := getTargetFiles(dir, w.extensions(), w.filter)
+	if err != nil {
+		logger.Error("failed to find target files", "path", dir, "error", err)
+		return
+	}
+	for _, f := range files {
+		w.render(f)
+	}
+}
+
+// create renderers again with the asset modified, and render all files
+func (w *watcher) reloadAll(path string) {
+	logger.Info("modification detected", "path", path)
+	if w.reload == nil {
+		return
+	}
+
+	next, err := w.reload(w.renderers)
+	if err != nil {
+		// keep rendering with the previous one until the asset is fixed
+		logger.Error("failed to reload", "path", path, "error", err)
+		return
+	}
+	w.renderers = next
+
+	files, err := getTargetFiles(w.root, w.extensions(), w.filter)
+	if err != nil {
+		logger.Error("failed to find target files", "path", w.root, "error", err)
+		return
+	}
+	for _, f := range files {
+		w.render(f)
+	}
+}
+
+// render the file. in site mode, the previous and next documents are rendered
+// again if the file is new or its title changed, so that their navigation
+// links to it with its title.
+func (w *watcher) render(path string) {
+	r := w.renderers.forFile(path)
+	// navigation is updated first, so that a new document has its own
+	changed, err := r.UpdateSite(path)
+	if err != nil {
+		logger.Warn("failed to update index page", "path", path, "error", err)
+	}
+
+	if err := r.Render(path); err != nil {
+		logger.Error("failed", "path", path, "error", err)
+		return
+	}
+	logger.Info("written", "path", path, "output", r.OutputPath(path))
+
+	if w.onRender != nil {
+		w.onRender(path)
+	}
+	if changed {
+		for _, f := range r.Adjacent(path) {
+			w.render(f)
+		}
+	}
+}
+
+// remove html file of the markdown file, and render the previous and next
+// documents again so that their navigation no longer links to it
+func (w *watcher) remove(path string) {
+	r := w.renderers.forFile(path)
+	adjacent := r.Adjacent(path)
+	if err := r.Remove(path); err != nil {
+		logger.Error("failed to remove", "path", path, "error", err)
+		return
+	}
+	logger.Info("removed", "path", path, "output", r.OutputPath(path))
+
+	for _, f := range adjacent {
+		// they may be removed together with a directory
+		if exists.File(f) {
+			w.render(f)
+		}
+	}
+}
+
+// watch directories of assets, partials, files included and images
+// referenced, which may be outside of the root directory.
+func (w *watcher) watchDependencies() {
+	for _, p := range append(w.renderers.Includes(), w.assets...) {
+		if dir := filepath.Dir(p); isDir(dir) {
+			w.watchDir(dir)
+		}
+	}
+	for _, pattern := range w.partials {
+		dirs, _ := filepath.Glob(filepath.Dir(pattern))
+		for _, dir := range dirs {
+			if isDir(dir) {
+				w.watchDir(dir)
+			}
+		}
+	}
+}
+
+func (w *watcher) watchDir(dir string) {
+	if w.dirs[dir] {
+		return
+	}
+	if err := w.fsw.Add(dir); err != nil {
+		logger.Warn("failed to watch directory", "path", dir, "error", err)
+		return
+	}
+	w.dirs[dir] = true
+}
+
+// see if the path is a markdown file rendered
+func (w *watcher) isTarget(path string) bool {
+	return isTargetFile(path, w.extensions()) && isUnder(w.root, path) && w.filter.allowFile(path)
+}
+
+func (w *watcher) isAsset(path string) bool {
+	for _, asset := range w.assets {
+		if asset == path {
+			return true
+		}
+	}
+	return w.isPartial(path)
+}
+
+// see if the path matches partial templates, whether it exists or not
+func (w *watcher) isPartial(path string) bool {
+	for _, pattern := range w.partials {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// extensions of markdown files, the same as the initial scan
+func (w *watcher) extensions() []string {
+	return w.renderers.root.Extensions
+}
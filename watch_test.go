@@ -0,0 +1,283 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-fsnotify/fsnotify"
+	"github.com/taq-f/miniature-potato/renderer"
+)
+
+func TestDebounceQueue(t *testing.T) {
+	now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	q := newDebounceQueue(200 * time.Millisecond)
+	q.now = func() time.Time { return now }
+
+	if _, ok := q.next(); ok {
+		t.Error("empty queue has a path due")
+	}
+
+	q.add("a.md")
+	now = now.Add(100 * time.Millisecond)
+	q.add("b.md")
+	// another event postpones the path
+	now = now.Add(50 * time.Millisecond)
+	q.add("a.md")
+
+	if d, ok := q.next(); !ok || d != 150*time.Millisecond {
+		t.Errorf("\ngot %v %v\nwant %v", d, ok, 150*time.Millisecond)
+	}
+
+	now = now.Add(150 * time.Millisecond)
+	if due := q.due(); strings.Join(due, ",") != "b.md" {
+		t.Errorf("\ngot %v\nwant %v", due, "b.md")
+	}
+
+	now = now.Add(100 * time.Millisecond)
+	if due := q.due(); strings.Join(due, ",") != "a.md" {
+		t.Errorf("\ngot %v\nwant %v", due, "a.md")
+	}
+	if _, ok := q.next(); ok {
+		t.Error("queue still has a path after all paths are taken")
+	}
+}
+
+func TestWatcherHandle(t *testing.T) {
+	root, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	src := filepath.Join(root, "src")
+	out := filepath.Join(root, "out")
+	os.MkdirAll(src, 0755)
+	template := filepath.Join(root, "template.html")
+	ioutil.WriteFile(template, []byte("v1 {{{content}}}"), 0644)
+
+	manifest, _ := renderer.LoadManifest(out)
+	newRs := func() *renderers {
+		content, _ := ioutil.ReadFile(template)
+		return newRenderers(&renderer.Renderer{Template: string(content), BaseDir: src, OutDir: out, Manifest: manifest})
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+	defer fsw.Close()
+
+	w := &watcher{
+		root:      src,
+		renderers: newRs(),
+		assets:    []string{template},
+		reload: func(prev *renderers) (*renderers, error) {
+			return newRs(), nil
+		},
+	}
+	w.init(fsw)
+
+	write := func(name, content string) string {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, []byte(content), 0644)
+		return path
+	}
+	read := func(name string) string {
+		content, err := ioutil.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+		if err != nil {
+			return ""
+		}
+		return string(content)
+	}
+
+	a := write("a.md", "# a\n")
+	w.handle([]string{a})
+	if !strings.Contains(read("a.html"), ">a</h1>") {
+		t.Errorf("new file is not rendered: %q", read("a.html"))
+	}
+
+	// renamed file is removed at the old path and rendered at the new one
+	b := filepath.Join(src, "b.md")
+	os.Rename(a, b)
+	w.handle([]string{a, b})
+	if read("a.html") != "" || !strings.Contains(read("b.html"), ">a</h1>") {
+		t.Errorf("html file is not moved:\na.html %q\nb.html %q", read("a.html"), read("b.html"))
+	}
+
+	// document referencing an image is rendered again when it changes
+	image := write("image.png", "png")
+	write("c.md", "![image](image.png)\n")
+	w.handle([]string{filepath.Join(src, "c.md")})
+	os.Remove(filepath.Join(out, "c.html"))
+	w.handle([]string{image})
+	if read("c.html") == "" {
+		t.Error("document is not rendered again when the image changes")
+	}
+
+	// files in a new directory are rendered, and removed with the directory
+	sub := filepath.Join(src, "sub")
+	write("sub/d.md", "# d\n")
+	w.handle([]string{sub})
+	if !w.dirs[sub] || read("sub/d.html") == "" {
+		t.Errorf("new directory is not handled: watched %v, d.html %q", w.dirs[sub], read("sub/d.html"))
+	}
+	os.RemoveAll(sub)
+	w.handle([]string{sub})
+	if w.dirs[sub] || read("sub/d.html") != "" {
+		t.Errorf("removed directory is not handled: watched %v, d.html %q", w.dirs[sub], read("sub/d.html"))
+	}
+
+	// all files are rendered again with the template modified
+	ioutil.WriteFile(template, []byte("v2 {{{content}}}"), 0644)
+	w.handle([]string{template})
+	if !strings.HasPrefix(read("b.html"), "v2 ") || !strings.HasPrefix(read("c.html"), "v2 ") {
+		t.Errorf("files are not rendered with the new template:\nb.html %q\nc.html %q", read("b.html"), read("c.html"))
+	}
+}
+
+func TestWatcherPartials(t *testing.T) {
+	root, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	src := filepath.Join(root, "src")
+	out := filepath.Join(root, "out")
+	partials := filepath.Join(root, "partials")
+	os.MkdirAll(src, 0755)
+	os.MkdirAll(partials, 0755)
+	pattern := filepath.Join(partials, "*.html")
+
+	manifest, _ := renderer.LoadManifest(out)
+	newRs := func() *renderers {
+		files, _ := filepath.Glob(pattern)
+		return newRenderers(&renderer.Renderer{
+			Template: `{{{content}}}{{block "footer" .}}{{end}}`,
+			Partials: files,
+			BaseDir:  src,
+			OutDir:   out,
+			Manifest: manifest,
+		})
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+	defer fsw.Close()
+
+	w := &watcher{
+		root:      src,
+		renderers: newRs(),
+		partials:  []string{pattern},
+		reload: func(prev *renderers) (*renderers, error) {
+			return newRs(), nil
+		},
+	}
+	w.init(fsw)
+
+	if !w.dirs[partials] {
+		t.Errorf("directory of partials is not watched: %v", w.dirs)
+	}
+
+	a := filepath.Join(src, "a.md")
+	ioutil.WriteFile(a, []byte("a\n"), 0644)
+	w.handle([]string{a})
+
+	read := func() string {
+		content, _ := ioutil.ReadFile(filepath.Join(out, "a.html"))
+		return string(content)
+	}
+
+	// partial added after watching started is loaded
+	footer := filepath.Join(partials, "footer.html")
+	ioutil.WriteFile(footer, []byte("footer"), 0644)
+	w.handle([]string{footer})
+	if !strings.Contains(read(), "footer") {
+		t.Errorf("new partial is not loaded: %q", read())
+	}
+
+	// and it is unloaded when removed
+	os.Remove(footer)
+	w.handle([]string{footer})
+	if strings.Contains(read(), "footer") {
+		t.Errorf("removed partial is still used: %q", read())
+	}
+}
+
+func TestWatcherSiteNavigation(t *testing.T) {
+	root, err := ioutil.TempDir("", "markdowner")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	src := filepath.Join(root, "src")
+	out := filepath.Join(root, "out")
+	os.MkdirAll(src, 0755)
+
+	var files []string
+	for _, name := range []string{"a.md", "b.md", "c.md"} {
+		file := filepath.Join(src, name)
+		ioutil.WriteFile(file, []byte("# "+name+"\n"), 0644)
+		files = append(files, file)
+	}
+
+	r := &renderer.Renderer{Template: `{{template "pagenav" .}}`, BaseDir: src, OutDir: out}
+	if err := r.BuildSite(files); err != nil {
+		t.Fatalf("BuildSite unexpectedly gave an error: %v", err)
+	}
+	for _, f := range files {
+		if err := r.Render(f); err != nil {
+			t.Fatalf("failed to render %s: %v", f, err)
+		}
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+	defer fsw.Close()
+
+	w := &watcher{root: src, renderers: newRenderers(r)}
+	w.init(fsw)
+
+	os.Remove(files[1])
+	w.handle([]string{files[1]})
+
+	read := func(name string) string {
+		content, _ := ioutil.ReadFile(filepath.Join(out, name))
+		return string(content)
+	}
+
+	// the previous and next documents of the removed one link to each other
+	if a := read("a.html"); strings.Contains(a, "b.html") || !strings.Contains(a, "c.html") {
+		t.Errorf("next of a.html is not updated: %q", a)
+	}
+	if c := read("c.html"); strings.Contains(c, "b.html") || !strings.Contains(c, "a.html") {
+		t.Errorf("previous of c.html is not updated: %q", c)
+	}
+
+	// and to the document added between them
+	ioutil.WriteFile(files[1], []byte("# b.md\n"), 0644)
+	w.handle([]string{files[1]})
+	if a := read("a.html"); !strings.Contains(a, "b.html") {
+		t.Errorf("next of a.html is not updated: %q", a)
+	}
+	if b := read("b.html"); !strings.Contains(b, "a.html") || !strings.Contains(b, "c.html") {
+		t.Errorf("navigation of b.html is missing: %q", b)
+	}
+
+	// with its new title
+	ioutil.WriteFile(files[1], []byte("# Renamed\n"), 0644)
+	w.handle([]string{files[1]})
+	if a, c := read("a.html"), read("c.html"); !strings.Contains(a, "Renamed") || !strings.Contains(c, "Renamed") {
+		t.Errorf("title of b.md is not updated:\na.html %q\nc.html %q", a, c)
+	}
+}